@@ -0,0 +1,24 @@
+package ini
+
+import (
+	"flag"
+)
+
+// ToFlagSet() defines a string flag on fs for every key of section, in
+// insertion order, with the stored value as default and the key comment as
+// usage. Keys for which fs already defines a flag are skipped.
+func (ini *Ini) ToFlagSet(fs *flag.FlagSet, section string) {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	for _, key := range ini.keys[section] {
+		if fs.Lookup(key) != nil {
+			continue
+		}
+		usage := ""
+		if l := ini.keyLayouts[section][key]; l != nil {
+			usage = l.comment
+		}
+		fs.String(key, ini.data[section][key], usage)
+	}
+}
@@ -0,0 +1,25 @@
+package ini
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestToFlagSet(t *testing.T) {
+	ini, err := LoadString("[server]\n; address to listen on\nhost = localhost\nport = 8080\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	ini.ToFlagSet(fs, "server")
+	if err := fs.Parse([]string{"-port", "9090"}); err != nil {
+		t.Fatal(err)
+	}
+	if v := fs.Lookup("host"); v == nil || v.Value.String() != "localhost" || v.Usage != "address to listen on" {
+		t.Errorf("Expected the host flag to default to \"localhost\", got %#v", v)
+	}
+	if v := fs.Lookup("port"); v == nil || v.Value.String() != "9090" || v.DefValue != "8080" {
+		t.Errorf("Expected the port flag to be overridden, got %#v", v)
+	}
+}
@@ -0,0 +1,351 @@
+package ini
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteSuffixes maps the size suffixes understood by GetBytes() to their multiplier.
+var byteSuffixes = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"kib", 1 << 10},
+	{"mib", 1 << 20},
+	{"gib", 1 << 30},
+	{"tib", 1 << 40},
+	{"kb", 1000},
+	{"mb", 1000 * 1000},
+	{"gb", 1000 * 1000 * 1000},
+	{"tb", 1000 * 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// GetRequired() returns the value associated to section and key. If key does
+// not exist, the returned error wraps ErrKeyNotFound.
+func (ini *Ini) GetRequired(section, key string) (string, error) {
+	value, ok := ini.GetOK(section, key)
+	if !ok {
+		return "", keyError(section, key, ErrKeyNotFound)
+	}
+	return value, nil
+}
+
+// GetInt() parses the value associated to section and key as an int. The
+// value may be signed and use a base prefix as accepted by strconv.ParseInt()
+// with base 0: "0x10" is 16, "010" is 8 and "0b10" is 2.
+// If key does not exist, the returned error wraps ErrKeyNotFound.
+func (ini *Ini) GetInt(section, key string) (int, error) {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(value, 0, 0)
+	if err != nil {
+		return 0, keyError(section, key, err)
+	}
+	return int(i), nil
+}
+
+// GetBool() parses the value associated to section and key with strconv.ParseBool().
+// If key does not exist, the returned error wraps ErrKeyNotFound.
+func (ini *Ini) GetBool(section, key string) (bool, error) {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, keyError(section, key, err)
+	}
+	return b, nil
+}
+
+// GetFloat64() parses the value associated to section and key as a float64.
+// If key does not exist, the returned error wraps ErrKeyNotFound.
+func (ini *Ini) GetFloat64(section, key string) (float64, error) {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, keyError(section, key, err)
+	}
+	return f, nil
+}
+
+// GetStringSlice() splits the value associated to section and key on commas
+// and returns the elements, trimmed of their surrounding whitespace. An empty
+// value yields an empty slice. If key does not exist, the returned error wraps
+// ErrKeyNotFound.
+func (ini *Ini) GetStringSlice(section, key string) ([]string, error) {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(value) == "" {
+		return []string{}, nil
+	}
+	elements := strings.Split(value, ",")
+	for i, e := range elements {
+		elements[i] = strings.TrimSpace(e)
+	}
+	return elements, nil
+}
+
+// GetIntSlice() is like GetStringSlice() but parses each element as an int.
+// The returned error tells which element, counting from 1, is malformed.
+func (ini *Ini) GetIntSlice(section, key string) ([]int, error) {
+	return getSlice(ini, section, key, func(e string) (int, error) {
+		i, err := strconv.ParseInt(e, 0, 0)
+		return int(i), err
+	})
+}
+
+// GetFloatSlice() is like GetStringSlice() but parses each element as a
+// float64. The returned error tells which element, counting from 1, is
+// malformed.
+func (ini *Ini) GetFloatSlice(section, key string) ([]float64, error) {
+	return getSlice(ini, section, key, func(e string) (float64, error) {
+		return strconv.ParseFloat(e, 64)
+	})
+}
+
+func getSlice[T any](ini *Ini, section, key string, parse func(string) (T, error)) ([]T, error) {
+	elements, err := ini.GetStringSlice(section, key)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]T, len(elements))
+	for i, e := range elements {
+		if values[i], err = parse(e); err != nil {
+			return nil, keyError(section, key, fmt.Errorf("Element %d: %w", i+1, err))
+		}
+	}
+	return values, nil
+}
+
+// GetPath() returns the file path associated to section and key, joined onto
+// baseDir if it is relative, such as the directory of the configuration file.
+// Absolute paths, paths starting with "~" and empty values are returned as
+// is, the "~" not being expanded.
+func (ini *Ini) GetPath(section, key, baseDir string) string {
+	path := ini.Get(section, key)
+	if path == "" || filepath.IsAbs(path) || strings.HasPrefix(path, "~") {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+// GetTime() parses the value associated to section and key with time.Parse()
+// using layout. If key does not exist, the returned error wraps ErrKeyNotFound.
+func (ini *Ini) GetTime(section, key, layout string) (time.Time, error) {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return time.Time{}, keyError(section, key, err)
+	}
+	return t, nil
+}
+
+// GetFloat32() parses the value associated to section and key as a float32.
+// If key does not exist, the returned error wraps ErrKeyNotFound.
+func (ini *Ini) GetFloat32(section, key string) (float32, error) {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(value, 32)
+	if err != nil {
+		return 0, keyError(section, key, err)
+	}
+	return float32(f), nil
+}
+
+// GetBytes() parses the value associated to section and key as a byte count.
+// The value is a number optionally followed by a decimal (KB, MB, GB, TB) or
+// binary (KiB, MiB, GiB, TiB) suffix, case insensitive. A bare number is a
+// number of bytes, and signed numbers are invalid. If key does not exist, the returned error wraps ErrKeyNotFound.
+func (ini *Ini) GetBytes(section, key string) (int64, error) {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return 0, err
+	}
+	number, multiplier := strings.TrimSpace(value), int64(1)
+	lower := strings.ToLower(number)
+	for _, s := range byteSuffixes {
+		if strings.HasSuffix(lower, s.suffix) {
+			number, multiplier = strings.TrimSpace(number[:len(number)-len(s.suffix)]), s.multiplier
+			break
+		}
+	}
+	// ParseUint rejects signs, a byte size cannot be negative.
+	n, err := strconv.ParseUint(number, 10, 64)
+	if err != nil || n > uint64(math.MaxInt64/multiplier) {
+		return 0, keyError(section, key, fmt.Errorf("Invalid byte size %q", value))
+	}
+	return int64(n) * multiplier, nil
+}
+
+// GetBigInt() parses the value associated to section and key as an integer of
+// any size, its base given by its prefix as for GetInt(). If key does not
+// exist, the returned error wraps ErrKeyNotFound.
+func (ini *Ini) GetBigInt(section, key string) (*big.Int, error) {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return nil, err
+	}
+	i, ok := new(big.Int).SetString(strings.TrimSpace(value), 0)
+	if !ok {
+		return nil, keyError(section, key, fmt.Errorf("Invalid integer %q", value))
+	}
+	return i, nil
+}
+
+// GetIP() parses the value associated to section and key as an IPv4 or IPv6
+// address. If key does not exist, the returned error wraps ErrKeyNotFound.
+func (ini *Ini) GetIP(section, key string) (net.IP, error) {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(strings.TrimSpace(value))
+	if ip == nil {
+		return nil, keyError(section, key, fmt.Errorf("Invalid IP address %q", value))
+	}
+	return ip, nil
+}
+
+// GetCIDR() parses the value associated to section and key as a network in
+// CIDR notation, such as "192.168.0.0/16". If key does not exist, the returned
+// error wraps ErrKeyNotFound.
+func (ini *Ini) GetCIDR(section, key string) (*net.IPNet, error) {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return nil, err
+	}
+	_, network, err := net.ParseCIDR(strings.TrimSpace(value))
+	if err != nil {
+		return nil, keyError(section, key, err)
+	}
+	return network, nil
+}
+
+// GetURL() parses the value associated to section and key as a URL. If key
+// does not exist, the returned error wraps ErrKeyNotFound.
+func (ini *Ini) GetURL(section, key string) (*url.URL, error) {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return nil, keyError(section, key, err)
+	}
+	return u, nil
+}
+
+// GetBytesBase64() decodes the value associated to section and key as
+// standard base64. If key does not exist, the returned error wraps
+// ErrKeyNotFound.
+func (ini *Ini) GetBytesBase64(section, key string) ([]byte, error) {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, keyError(section, key, err)
+	}
+	return b, nil
+}
+
+// GetRegexp() compiles the value associated to section and key as a regular
+// expression. If key does not exist, the returned error wraps ErrKeyNotFound.
+func (ini *Ini) GetRegexp(section, key string) (*regexp.Regexp, error) {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return nil, keyError(section, key, err)
+	}
+	return re, nil
+}
+
+// GetJSON() unmarshals the JSON document stored as the value associated to
+// section and key into v. If key does not exist, the returned error wraps
+// ErrKeyNotFound.
+func (ini *Ini) GetJSON(section, key string, v interface{}) error {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(value), v); err != nil {
+		return keyError(section, key, err)
+	}
+	return nil
+}
+
+// GetEnum() returns the value associated to section and key if it is one of
+// allowed, and an error listing the allowed values otherwise. If key does not
+// exist, the returned error wraps ErrKeyNotFound.
+func (ini *Ini) GetEnum(section, key string, allowed []string) (string, error) {
+	return ini.getEnum(section, key, allowed, func(a, b string) bool { return a == b })
+}
+
+// GetEnumFold() is like GetEnum() but matches the value case-insensitively.
+// The matching value of allowed is returned.
+func (ini *Ini) GetEnumFold(section, key string, allowed []string) (string, error) {
+	return ini.getEnum(section, key, allowed, strings.EqualFold)
+}
+
+func (ini *Ini) getEnum(section, key string, allowed []string, equal func(a, b string) bool) (string, error) {
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return "", err
+	}
+	for _, a := range allowed {
+		if equal(value, a) {
+			return a, nil
+		}
+	}
+	return "", keyError(section, key, fmt.Errorf("Invalid value %q, expected one of %q", value, allowed))
+}
+
+// GetAs() parses the value associated to section and key in ini with parse,
+// for types not covered by the typed getters. If key does not exist, the
+// returned error wraps ErrKeyNotFound, and errors returned by parse are
+// wrapped with the location of key.
+func GetAs[T any](ini *Ini, section, key string, parse func(string) (T, error)) (T, error) {
+	var zero T
+	value, err := ini.GetRequired(section, key)
+	if err != nil {
+		return zero, err
+	}
+	v, err := parse(value)
+	if err != nil {
+		return zero, keyError(section, key, err)
+	}
+	return v, nil
+}
+
+// keyError wraps err with the location of key.
+func keyError(section, key string, err error) error {
+	return fmt.Errorf("Key %q in section %q: %w", key, section, err)
+}
@@ -0,0 +1,379 @@
+package ini
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetRequired(t *testing.T) {
+	ini := NewIni()
+	ini.Set("db", "host", "localhost")
+
+	if v, err := ini.GetRequired("db", "host"); err != nil || v != "localhost" {
+		t.Errorf("Expected \"localhost\", got %#v, %v", v, err)
+	}
+	if _, err := ini.GetRequired("db", "port"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestGetTime(t *testing.T) {
+	ini := NewIni()
+	ini.Set("cron", "start", "2015-02-25T10:30:00Z")
+	ini.Set("cron", "day", "2015-02-25")
+	ini.Set("cron", "broken", "tomorrow")
+
+	if v, err := ini.GetTime("cron", "start", time.RFC3339); err != nil {
+		t.Error(err)
+	} else if !v.Equal(time.Date(2015, 2, 25, 10, 30, 0, 0, time.UTC)) {
+		t.Errorf("Got %v", v)
+	}
+	if v, err := ini.GetTime("cron", "day", "2006-01-02"); err != nil {
+		t.Error(err)
+	} else if !v.Equal(time.Date(2015, 2, 25, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Got %v", v)
+	}
+	if _, err := ini.GetTime("cron", "broken", time.RFC3339); err == nil {
+		t.Error("malformed value should return an error")
+	}
+	if _, err := ini.GetTime("cron", "stop", time.RFC3339); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestGetBytes(t *testing.T) {
+	ini := NewIni()
+	values := map[string]int64{
+		"512":   512,
+		"1KB":   1000,
+		"1KiB":  1024,
+		"2MiB":  2 << 20,
+		"1gb":   1000 * 1000 * 1000,
+		"10 mb": 10 * 1000 * 1000,
+	}
+	for value, expected := range values {
+		ini.Set("limits", "size", value)
+		if v, err := ini.GetBytes("limits", "size"); err != nil {
+			t.Errorf("%s: %s", value, err)
+		} else if v != expected {
+			t.Errorf("%s: expected %d, got %d", value, expected, v)
+		}
+	}
+
+	ini.Set("limits", "size", "10XX")
+	if _, err := ini.GetBytes("limits", "size"); err == nil {
+		t.Error("invalid suffix should return an error")
+	}
+	for _, value := range []string{"-1KB", "+1KB"} {
+		ini.Set("limits", "size", value)
+		if _, err := ini.GetBytes("limits", "size"); err == nil {
+			t.Errorf("%s: a signed size should return an error", value)
+		}
+	}
+	if _, err := ini.GetBytes("limits", "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestGetFloat32(t *testing.T) {
+	ini := NewIni()
+	ini.Set("audio", "volume", "0.5")
+	ini.Set("audio", "gain", "1e40")
+	ini.Set("audio", "balance", "left")
+
+	if v, err := ini.GetFloat32("audio", "volume"); err != nil {
+		t.Error(err)
+	} else if v != 0.5 {
+		t.Errorf("Expected 0.5, got %v", v)
+	}
+	if _, err := ini.GetFloat32("audio", "gain"); err == nil {
+		t.Error("value out of float32 range should return an error")
+	}
+	if _, err := ini.GetFloat32("audio", "balance"); err == nil {
+		t.Error("malformed value should return an error")
+	}
+	if _, err := ini.GetFloat32("audio", "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestTypedGetters(t *testing.T) {
+	ini, err := LoadString("[server]\nport = 8080\ndebug = true\nratio = 0.25\nname = web\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := ini.GetInt("server", "port"); err != nil || v != 8080 {
+		t.Errorf("Expected 8080, got %v, %v", v, err)
+	}
+	if v, err := ini.GetBool("server", "debug"); err != nil || !v {
+		t.Errorf("Expected true, got %v, %v", v, err)
+	}
+	if v, err := ini.GetFloat64("server", "ratio"); err != nil || v != 0.25 {
+		t.Errorf("Expected 0.25, got %v, %v", v, err)
+	}
+	if _, err := ini.GetInt("server", "name"); err == nil {
+		t.Error("malformed int should return an error")
+	}
+	if _, err := ini.GetBool("server", "name"); err == nil {
+		t.Error("malformed bool should return an error")
+	}
+	if _, err := ini.GetFloat64("server", "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestGetIntBases(t *testing.T) {
+	ini := NewIni()
+	values := map[string]int{
+		"+5":   5,
+		"-5":   -5,
+		"0x10": 16,
+		"010":  8,
+	}
+	for value, expected := range values {
+		ini.Set("server", "n", value)
+		if v, err := ini.GetInt("server", "n"); err != nil {
+			t.Errorf("%s: %s", value, err)
+		} else if v != expected {
+			t.Errorf("%s: expected %d, got %d", value, expected, v)
+		}
+	}
+}
+
+func TestGetIP(t *testing.T) {
+	ini := NewIni()
+	ini.Set("server", "v4", "192.168.1.10")
+	ini.Set("server", "v6", "2001:db8::1")
+	ini.Set("server", "broken", "192.168.1")
+	ini.Set("server", "network", "10.0.0.0/8")
+	ini.Set("server", "network6", "2001:db8::/32")
+
+	if v, err := ini.GetIP("server", "v4"); err != nil {
+		t.Error(err)
+	} else if !v.Equal(net.IPv4(192, 168, 1, 10)) {
+		t.Errorf("Got %v", v)
+	}
+	if v, err := ini.GetIP("server", "v6"); err != nil {
+		t.Error(err)
+	} else if v.String() != "2001:db8::1" {
+		t.Errorf("Got %v", v)
+	}
+	if _, err := ini.GetIP("server", "broken"); err == nil {
+		t.Error("malformed value should return an error")
+	}
+	if _, err := ini.GetIP("server", "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	if v, err := ini.GetCIDR("server", "network"); err != nil {
+		t.Error(err)
+	} else if v.String() != "10.0.0.0/8" {
+		t.Errorf("Got %v", v)
+	}
+	if v, err := ini.GetCIDR("server", "network6"); err != nil {
+		t.Error(err)
+	} else if v.String() != "2001:db8::/32" {
+		t.Errorf("Got %v", v)
+	}
+	if _, err := ini.GetCIDR("server", "v4"); err == nil {
+		t.Error("address without a prefix length should return an error")
+	}
+	if _, err := ini.GetCIDR("server", "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestGetURL(t *testing.T) {
+	ini := NewIni()
+	ini.Set("api", "endpoint", "https://api.example.com:8443/v1?debug=1")
+	ini.Set("api", "broken", "://missing-scheme")
+
+	if v, err := ini.GetURL("api", "endpoint"); err != nil {
+		t.Error(err)
+	} else if v.Scheme != "https" || v.Hostname() != "api.example.com" || v.Port() != "8443" || v.Path != "/v1" {
+		t.Errorf("Got %v", v)
+	}
+	if _, err := ini.GetURL("api", "broken"); err == nil {
+		t.Error("malformed value should return an error")
+	}
+	if _, err := ini.GetURL("api", "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestGetJSON(t *testing.T) {
+	ini := NewIni()
+	ini.Set("app", "limits", `{"a":1}`)
+	ini.Set("app", "broken", `{"a":`)
+
+	var limits struct {
+		A int `json:"a"`
+	}
+	if err := ini.GetJSON("app", "limits", &limits); err != nil {
+		t.Error(err)
+	} else if limits.A != 1 {
+		t.Errorf("Expected 1, got %d", limits.A)
+	}
+	if err := ini.GetJSON("app", "broken", &limits); err == nil {
+		t.Error("malformed value should return an error")
+	}
+	if err := ini.GetJSON("app", "missing", &limits); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestGetEnum(t *testing.T) {
+	ini := NewIni()
+	ini.Set("log", "level", "warn")
+	ini.Set("log", "format", "JSON")
+	allowed := []string{"debug", "info", "warn", "error"}
+
+	if v, err := ini.GetEnum("log", "level", allowed); err != nil || v != "warn" {
+		t.Errorf("Expected \"warn\", got %#v, %v", v, err)
+	}
+	_, err := ini.GetEnum("log", "format", []string{"text", "json"})
+	if err == nil || !strings.Contains(err.Error(), `["text" "json"]`) {
+		t.Errorf("Expected an error listing the allowed values, got %v", err)
+	}
+	if v, err := ini.GetEnumFold("log", "format", []string{"text", "json"}); err != nil || v != "json" {
+		t.Errorf("Expected \"json\", got %#v, %v", v, err)
+	}
+	if _, err := ini.GetEnum("log", "missing", allowed); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestGetAs(t *testing.T) {
+	type point struct{ x, y int }
+	parsePoint := func(value string) (point, error) {
+		var p point
+		if _, err := fmt.Sscanf(value, "%d,%d", &p.x, &p.y); err != nil {
+			return point{}, err
+		}
+		return p, nil
+	}
+	ini := NewIni()
+	ini.Set("window", "origin", "10,20")
+	ini.Set("window", "broken", "10")
+
+	if v, err := GetAs(ini, "window", "origin", parsePoint); err != nil || v != (point{10, 20}) {
+		t.Errorf("Expected {10 20}, got %v, %v", v, err)
+	}
+	if _, err := GetAs(ini, "window", "broken", parsePoint); err == nil || !strings.Contains(err.Error(), `"broken"`) {
+		t.Errorf("Expected an error with the key location, got %v", err)
+	}
+	if _, err := GetAs(ini, "window", "missing", parsePoint); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestGetBytesBase64(t *testing.T) {
+	blob := []byte{0x01, 0x02, 0x03, 0xff}
+	ini, err := LoadString("[tls]\nkey = " + base64.StdEncoding.EncodeToString(blob) + "\nbroken = not base64!\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := ini.GetBytesBase64("tls", "key"); err != nil || !bytes.Equal(v, blob) {
+		t.Errorf("Expected %v, got %v, %v", blob, v, err)
+	}
+	if _, err := ini.GetBytesBase64("tls", "broken"); err == nil {
+		t.Error("malformed value should return an error")
+	}
+	if _, err := ini.GetBytesBase64("tls", "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestGetSlices(t *testing.T) {
+	ini := NewIni()
+	ini.Set("numbers", "ints", "1, 2,3")
+	ini.Set("numbers", "floats", "1.5,2,-3e2")
+	ini.Set("numbers", "broken", "1,x,3")
+	ini.Set("numbers", "empty", "")
+
+	if v, err := ini.GetStringSlice("numbers", "ints"); err != nil || strings.Join(v, "|") != "1|2|3" {
+		t.Errorf("Expected [1 2 3], got %#v, %v", v, err)
+	}
+	if v, err := ini.GetIntSlice("numbers", "ints"); err != nil || len(v) != 3 || v[0] != 1 || v[1] != 2 || v[2] != 3 {
+		t.Errorf("Expected [1 2 3], got %#v, %v", v, err)
+	}
+	if v, err := ini.GetFloatSlice("numbers", "floats"); err != nil || len(v) != 3 || v[0] != 1.5 || v[1] != 2 || v[2] != -300 {
+		t.Errorf("Expected [1.5 2 -300], got %#v, %v", v, err)
+	}
+	if _, err := ini.GetIntSlice("numbers", "broken"); err == nil || !strings.Contains(err.Error(), "Element 2") {
+		t.Errorf("Expected an error on element 2, got %v", err)
+	}
+	if v, err := ini.GetIntSlice("numbers", "empty"); err != nil || len(v) != 0 {
+		t.Errorf("Expected an empty slice, got %#v, %v", v, err)
+	}
+	if _, err := ini.GetFloatSlice("numbers", "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestGetRegexp(t *testing.T) {
+	ini := NewIni()
+	ini.Set("filter", "version", `^v(\d+)\.(\d+)$`)
+	ini.Set("filter", "broken", `v(\d+`)
+
+	if re, err := ini.GetRegexp("filter", "version"); err != nil {
+		t.Error(err)
+	} else if !re.MatchString("v1.12") || re.MatchString("1.12") {
+		t.Errorf("Unexpected matches for %v", re)
+	}
+	if _, err := ini.GetRegexp("filter", "broken"); err == nil {
+		t.Error("malformed value should return an error")
+	}
+	if _, err := ini.GetRegexp("filter", "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestGetBigInt(t *testing.T) {
+	ini := NewIni()
+	ini.Set("crypto", "modulus", "1234567890123456789012345678901234567890")
+	ini.Set("crypto", "hex", "0xffffffffffffffffffff")
+	ini.Set("crypto", "broken", "12ab")
+
+	if v, err := ini.GetBigInt("crypto", "modulus"); err != nil || v.String() != "1234567890123456789012345678901234567890" {
+		t.Errorf("Expected the 40 digit number, got %v, %v", v, err)
+	}
+	if v, err := ini.GetBigInt("crypto", "hex"); err != nil || v.Text(16) != "ffffffffffffffffffff" {
+		t.Errorf("Expected 0xffffffffffffffffffff, got %v, %v", v, err)
+	}
+	if _, err := ini.GetBigInt("crypto", "broken"); err == nil {
+		t.Error("malformed value should return an error")
+	}
+	if _, err := ini.GetBigInt("crypto", "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestGetPath(t *testing.T) {
+	ini, err := LoadString(gitConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ini.Set("paths", "relative", "data/cache")
+	ini.Set("paths", "absolute", "/var/lib/app")
+
+	if v := ini.GetPath("paths", "relative", "/etc/app"); v != "/etc/app/data/cache" {
+		t.Errorf("Expected \"/etc/app/data/cache\", got %#v", v)
+	}
+	if v := ini.GetPath("paths", "absolute", "/etc/app"); v != "/var/lib/app" {
+		t.Errorf("Expected \"/var/lib/app\", got %#v", v)
+	}
+	if v := ini.GetPath("core", "excludesfile", "/etc/app"); v != "~/.gitignore" {
+		t.Errorf("Expected \"~/.gitignore\", got %#v", v)
+	}
+	if v := ini.GetPath("paths", "missing", "/etc/app"); v != "" {
+		t.Errorf("Expected an empty path, got %#v", v)
+	}
+}
@@ -3,10 +3,16 @@ package ini
 
 import (
 	"bytes"
+	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"text/scanner"
@@ -18,23 +24,144 @@ const (
 	tokenCommentClassic = ';'
 	tokenCommentHash    = '#'
 	tokenSpace          = ' '
+	tokenTab            = '\t'
 	tokenLF             = '\n'
 	tokenCR             = '\r'
+	tokenEscape         = '\\'
+	tokenDirective      = '@'
+
+	directiveInclude = "@include"
+	arrayKeySuffix   = "[]"
 )
 
 var (
 	envvarRegexp = regexp.MustCompile(`\${[a-zA-Z_]+[a-zA-Z0-9_]*}`)
+
+	escapeReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`, `"`, `\"`)
+
+	// ErrKeyNotFound is returned by the typed getters when the key does not exist.
+	ErrKeyNotFound = errors.New("Key not found")
 )
 
 // Ini structure contains the data and a RWMutex for concurrency safety
 type Ini struct {
-	data map[string]map[string]string
-	rw   sync.RWMutex
+	data               map[string]map[string]string
+	sections           []string                       // sections in insertion order
+	keys               map[string][]string            // keys of each section in insertion order
+	multi              map[string]map[string][]string // values of the keys holding several
+	sectionLayouts     map[string]*layout
+	keyLayouts         map[string]map[string]*layout
+	sortKeys           bool
+	preserveFormatting bool
+	unescape           bool
+	unescapeQuoted     bool
+	globalLabel        string
+	globalLast         bool
+	globalAlias        string
+	commentPrefixes    []string
+	allowBareKeys      bool
+	includeDir         string
+	trimValues         bool
+	writeEmptySections bool
+	allowGlobalKeys    bool
+	arrayKeys          bool
+	indent             string
+	delimiter          string
+	maxValueLength     int
+	maxLineLength      int
+	maxEntries         int
+	header             string
+	mergeDuplicates    bool
+	sectionSeparator   string
+	lineEnding         string
+	lineParser         bool
+	disallowEmpty      bool
+	warn               func(Warning) // set while reading with warnings
+	lowercaseKeys      bool
+	keyNormalizer      func(string) string
+	rw                 sync.RWMutex
+}
+
+// layout holds the formatting read around a section header or a key, so that
+// WriteTo() can reproduce it when formatting is preserved.
+type layout struct {
+	blankLines int    // number of blank lines preceding the line
+	quoted     bool   // whether the value was quoted
+	comment    string // comment lines immediately preceding the line
+	inline     string // comment following the value on the same line
+	raw        string // value as read, before unquoting and unescaping
 }
 
 // Instantiates a new Ini structure
 func NewIni() *Ini {
-	return &Ini{data: make(map[string]map[string]string)}
+	return &Ini{
+		data:             make(map[string]map[string]string),
+		keys:             make(map[string][]string),
+		multi:            make(map[string]map[string][]string),
+		sectionLayouts:   make(map[string]*layout),
+		keyLayouts:       make(map[string]map[string]*layout),
+		commentPrefixes:  []string{string(tokenCommentClassic), string(tokenCommentHash)},
+		trimValues:       true,
+		allowGlobalKeys:  true,
+		mergeDuplicates:  true,
+		sectionSeparator: ":",
+	}
+}
+
+// Load() returns a new Ini structure populated with the configuration contained in data.
+func Load(data []byte) (*Ini, error) {
+	ini := NewIni()
+	if _, err := ini.ReadFrom(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return ini, nil
+}
+
+// LoadString() returns a new Ini structure populated with the configuration contained in s.
+func LoadString(s string) (*Ini, error) {
+	ini := NewIni()
+	if _, err := ini.ReadFrom(strings.NewReader(s)); err != nil {
+		return nil, err
+	}
+	return ini, nil
+}
+
+// LoadFS() returns a new Ini structure populated with the configuration
+// contained in the file name of fsys, such as an embed.FS.
+func LoadFS(fsys fs.FS, name string) (*Ini, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ini := NewIni()
+	if _, err := ini.ReadFrom(f); err != nil {
+		return nil, err
+	}
+	return ini, nil
+}
+
+// LoadFileGzip() returns a new Ini structure populated with the configuration
+// contained in the gzip-compressed file at path.
+func LoadFileGzip(path string) (*Ini, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	ini := NewIni()
+	if _, err := ini.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return ini, nil
 }
 
 // Get() returns the value associated to section and key. If key is not in a section, use ""
@@ -43,19 +170,227 @@ func (ini *Ini) Get(section, key string) string {
 	ini.rw.RLock()
 	defer ini.rw.RUnlock()
 
-	if _, ok := ini.data[section]; !ok {
+	keys, ok := ini.data[section]
+	if !ok {
 		return ""
 	}
+	return keys[ini.normalizeKey(key)]
+}
+
+// GetNested() returns the value of the key at the end of path, the elements
+// before it naming nested sections. Section names are stored as written, so
+// GetNested("a", "b", "key") is Get("a.b", "key") and reads the key of an
+// [a.b] section.
+func (ini *Ini) GetNested(path ...string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	return ini.Get(strings.Join(path[:len(path)-1], "."), path[len(path)-1])
+}
+
+// GetFold() is like Get() but matches section and key case-insensitively.
+// An exact match is preferred, otherwise the first match in insertion order
+// is returned.
+func (ini *Ini) GetFold(section, key string) string {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	if value, ok := ini.data[section][key]; ok {
+		return value
+	}
+	for _, s := range ini.sections {
+		if !strings.EqualFold(s, section) {
+			continue
+		}
+		for _, k := range ini.keys[s] {
+			if strings.EqualFold(k, key) {
+				return ini.data[s][k]
+			}
+		}
+	}
+	return ""
+}
+
+// GetOK() returns the value associated to section and key, and whether the key exists.
+func (ini *Ini) GetOK(section, key string) (string, bool) {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	value, ok := ini.data[section][ini.normalizeKey(key)]
+	return value, ok
+}
+
+// GetFallback() returns the value of key in the first of sections holding it,
+// or an empty string if none does.
+func (ini *Ini) GetFallback(key string, sections ...string) string {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	key = ini.normalizeKey(key)
+	for _, section := range sections {
+		if value, ok := ini.data[section][key]; ok {
+			return value
+		}
+	}
+	return ""
+}
 
+// GetRaw() returns the value associated to section and key exactly as it was
+// read, quotes and escape sequences included, such as `"localhost"` for a
+// quoted localhost. Values set since are returned as is.
+func (ini *Ini) GetRaw(section, key string) string {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	key = ini.normalizeKey(key)
+	if l, ok := ini.keyLayouts[section][key]; ok && l.raw != "" {
+		return l.raw
+	}
 	return ini.data[section][key]
 }
 
+// Comment() returns the comment lines read immediately above key in section,
+// without their comment prefix and joined with newlines. A blank line between a
+// comment and a key detaches the comment.
+func (ini *Ini) Comment(section, key string) string {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	if l, ok := ini.keyLayouts[section][ini.normalizeKey(key)]; ok {
+		return l.comment
+	}
+	return ""
+}
+
+// GetAll() returns every value associated to section and key, in the order
+// they were appended. If key does not exist, GetAll() returns nil.
+func (ini *Ini) GetAll(section, key string) []string {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	return ini.valuesOf(section, ini.normalizeKey(key))
+}
+
 // Set() sets the value of a key for a given section.
 func (ini *Ini) Set(section, key, value string) {
 	ini.rw.Lock()
 	defer ini.rw.Unlock()
 
+	ini.set(section, ini.normalizeKey(key), value)
+}
+
+// GetOrSet() returns the value of key in section if it exists. Otherwise it
+// sets key to value and returns value. Both happen under a single lock.
+func (ini *Ini) GetOrSet(section, key, value string) string {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	key = ini.normalizeKey(key)
+	if current, ok := ini.data[section][key]; ok {
+		return current
+	}
 	ini.set(section, key, value)
+	return value
+}
+
+// SetAll() sets every key of kv in section, under a single lock. New keys are
+// inserted in alphabetical order.
+func (ini *Ini) SetAll(section string, kv map[string]string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	for _, key := range sortedKeys(kv) {
+		ini.set(section, ini.normalizeKey(key), kv[key])
+	}
+}
+
+// AppendValue() adds a value to a key for a given section, keeping the values
+// it already holds. Get() returns the last value appended, GetAll() all of them.
+func (ini *Ini) AppendValue(section, key, value string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.appendValue(section, ini.normalizeKey(key), value)
+}
+
+// AddSection() creates section if it does not exist yet, without any key.
+func (ini *Ini) AddSection(section string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.addSection(section)
+}
+
+// SetInt() sets the value of a key for a given section to the decimal form of v.
+func (ini *Ini) SetInt(section, key string, v int) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.set(section, ini.normalizeKey(key), strconv.Itoa(v))
+}
+
+// SetBool() sets the value of a key for a given section to "true" or "false".
+func (ini *Ini) SetBool(section, key string, v bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.set(section, ini.normalizeKey(key), strconv.FormatBool(v))
+}
+
+// SetFloat64() sets the value of a key for a given section to the shortest
+// form of v that parses back to v.
+func (ini *Ini) SetFloat64(section, key string, v float64) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.set(section, ini.normalizeKey(key), strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+// SetMulti() replaces every value of a key for a given section with values.
+// Get() then returns the last of them. An empty values removes the key.
+func (ini *Ini) SetMulti(section, key string, values []string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	key = ini.normalizeKey(key)
+	if len(values) == 0 {
+		ini.deleteKey(section, key)
+		return
+	}
+	ini.set(section, key, values[0])
+	for _, value := range values[1:] {
+		ini.appendValue(section, key, value)
+	}
+}
+
+// SetComment() sets the comment written by WriteTo() above key in section.
+// Each line of a multi-line comment is written with the comment prefix.
+func (ini *Ini) SetComment(section, key, comment string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.keyLayout(section, ini.normalizeKey(key)).comment = comment
+}
+
+// InlineComment() returns the comment read after the value of key in section,
+// on the same line, without its comment prefix.
+func (ini *Ini) InlineComment(section, key string) string {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	if l, ok := ini.keyLayouts[section][ini.normalizeKey(key)]; ok {
+		return l.inline
+	}
+	return ""
+}
+
+// SetInlineComment() sets the comment written by WriteTo() after the value of
+// key in section, on the same line.
+func (ini *Ini) SetInlineComment(section, key, comment string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.keyLayout(section, ini.normalizeKey(key)).inline = comment
 }
 
 func (ini *Ini) HasSection(section string) bool {
@@ -66,6 +401,257 @@ func (ini *Ini) HasSection(section string) bool {
 	return ok
 }
 
+// SectionMapOrDefault() returns a copy of the keys and values of section, or
+// def if section does not exist.
+func (ini *Ini) SectionMapOrDefault(section string, def map[string]string) map[string]string {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	data, ok := ini.data[section]
+	if !ok {
+		return def
+	}
+	values := make(map[string]string, len(data))
+	for key, value := range data {
+		values[key] = value
+	}
+	return values
+}
+
+// Len() returns the total number of keys across all sections.
+func (ini *Ini) Len() int {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	n := 0
+	for _, keys := range ini.data {
+		n += len(keys)
+	}
+	return n
+}
+
+// SectionLen() returns the number of keys in section, 0 if it does not exist.
+func (ini *Ini) SectionLen(section string) int {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	return len(ini.data[section])
+}
+
+// Each() calls fn for every key, section by section in insertion order.
+// The entries are copied under the read lock and fn is called without holding
+// it, so a slow fn does not block writers and fn may itself modify ini.
+func (ini *Ini) Each(fn func(section, key, value string)) {
+	for _, e := range ini.Entries() {
+		fn(e.Section, e.Key, e.Value)
+	}
+}
+
+// Walk() is like Each() but stops at the first error returned by fn and
+// returns it.
+func (ini *Ini) Walk(fn func(section, key, value string) error) error {
+	for _, e := range ini.Entries() {
+		if err := fn(e.Section, e.Key, e.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Diff() compares ini with other and returns, as "section.key" identifiers, the
+// keys only present in other, the keys only present in ini, and the keys whose
+// values differ.
+func (ini *Ini) Diff(other *Ini) (added, removed, changed []string) {
+	theirs := make(map[Entry]string)
+	otherEntries := other.Entries()
+	for _, e := range otherEntries {
+		theirs[Entry{Section: e.Section, Key: e.Key}] = e.Value
+	}
+	ours := make(map[Entry]bool)
+	for _, e := range ini.Entries() {
+		id := Entry{Section: e.Section, Key: e.Key}
+		ours[id] = true
+		if value, ok := theirs[id]; !ok {
+			removed = append(removed, e.Section+"."+e.Key)
+		} else if value != e.Value {
+			changed = append(changed, e.Section+"."+e.Key)
+		}
+	}
+	for _, e := range otherEntries {
+		if !ours[Entry{Section: e.Section, Key: e.Key}] {
+			added = append(added, e.Section+"."+e.Key)
+		}
+	}
+	return added, removed, changed
+}
+
+// Merge() copies every key of other into ini, overwriting the keys already set.
+func (ini *Ini) Merge(other *Ini) {
+	ini.MergeFunc(other, func(section, key, a, b string) string {
+		return b
+	})
+}
+
+// MergeFunc() copies every key of other into ini. When a key is set in both,
+// resolve is called with the value of ini and the value of other and its
+// result is stored. resolve is called with ini locked and must not use it.
+func (ini *Ini) MergeFunc(other *Ini, resolve func(section, key, a, b string) string) {
+	entries := other.Entries()
+
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	for _, e := range entries {
+		key, value := ini.normalizeKey(e.Key), e.Value
+		if current, ok := ini.data[e.Section][key]; ok {
+			value = resolve(e.Section, key, current, e.Value)
+		}
+		ini.set(e.Section, key, value)
+	}
+}
+
+// Entry is a key of a section and its value.
+type Entry struct {
+	Section, Key, Value string
+}
+
+// Entries() returns a copy of every key and its value, section by section in
+// insertion order.
+func (ini *Ini) Entries() []Entry {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	var entries []Entry
+	for _, section := range ini.sections {
+		for _, key := range ini.keys[section] {
+			entries = append(entries, Entry{section, key, ini.data[section][key]})
+		}
+	}
+	return entries
+}
+
+// SectionAt() returns the name of the i-th section in insertion order, the ""
+// section included if it holds keys, and false if there is no such section.
+func (ini *Ini) SectionAt(i int) (string, bool) {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	if i < 0 || i >= len(ini.sections) {
+		return "", false
+	}
+	return ini.sections[i], true
+}
+
+// Keys() returns the keys of section in insertion order.
+func (ini *Ini) Keys(section string) []string {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	return append([]string(nil), ini.keys[section]...)
+}
+
+// SortedKeys() returns the keys of section in alphabetical order.
+func (ini *Ini) SortedKeys(section string) []string {
+	keys := ini.Keys(section)
+	sort.Strings(keys)
+	return keys
+}
+
+// KeysWithPrefix() returns the keys of section starting with prefix, in
+// alphabetical order.
+func (ini *Ini) KeysWithPrefix(section, prefix string) []string {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	var keys []string
+	for _, key := range ini.keys[section] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetStringMap() returns the keys of section starting with prefix followed by
+// a dot, such as "db.host" and "db.port" for prefix "db", keyed by the rest of
+// their name. The map is empty if no key matches.
+func (ini *Ini) GetStringMap(section, prefix string) map[string]string {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	values := make(map[string]string)
+	prefix += "."
+	for _, key := range ini.keys[section] {
+		if strings.HasPrefix(key, prefix) {
+			values[strings.TrimPrefix(key, prefix)] = ini.data[section][key]
+		}
+	}
+	return values
+}
+
+// ParseSectionName() splits a structured section name such as
+// "feature:enabled" on the first section separator, and returns "feature" and
+// "enabled". The tag is empty if section holds no separator.
+func (ini *Ini) ParseSectionName(section string) (base, tag string) {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	if ini.sectionSeparator == "" {
+		return section, ""
+	}
+	base, tag, _ = strings.Cut(section, ini.sectionSeparator)
+	return base, tag
+}
+
+// RenameSection() moves all keys of section old to section new.
+// It returns an error if old does not exist or if new already exists.
+func (ini *Ini) RenameSection(old, new string) error {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	if _, ok := ini.data[old]; !ok {
+		return fmt.Errorf("Section %q does not exist", old)
+	}
+	if _, ok := ini.data[new]; ok {
+		return fmt.Errorf("Section %q already exists", new)
+	}
+	ini.moveSection(old, new)
+	return nil
+}
+
+// RenameKey() moves the value of oldKey to newKey within section, keeping its
+// position. It returns an error if oldKey does not exist or if newKey already exists.
+func (ini *Ini) RenameKey(section, oldKey, newKey string) error {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	oldKey, newKey = ini.normalizeKey(oldKey), ini.normalizeKey(newKey)
+	if _, ok := ini.data[section][oldKey]; !ok {
+		return fmt.Errorf("Key %q does not exist in section %q", oldKey, section)
+	}
+	if _, ok := ini.data[section][newKey]; ok {
+		return fmt.Errorf("Key %q already exists in section %q", newKey, section)
+	}
+
+	ini.data[section][newKey] = ini.data[section][oldKey]
+	delete(ini.data[section], oldKey)
+	if values, ok := ini.multi[section][oldKey]; ok {
+		ini.multi[section][newKey] = values
+		delete(ini.multi[section], oldKey)
+	}
+	if l, ok := ini.keyLayouts[section][oldKey]; ok {
+		ini.keyLayouts[section][newKey] = l
+		delete(ini.keyLayouts[section], oldKey)
+	}
+	for i, key := range ini.keys[section] {
+		if key == oldKey {
+			ini.keys[section][i] = newKey
+		}
+	}
+	return nil
+}
+
 // Has() returns true if the ini structure has corresponding value in section/key
 func (ini *Ini) Has(section, key string) bool {
 	ini.rw.RLock()
@@ -74,65 +660,720 @@ func (ini *Ini) Has(section, key string) bool {
 	if _, ok := ini.data[section]; !ok {
 		return false
 	}
-	if _, ok := ini.data[section][key]; !ok {
+	if _, ok := ini.data[section][ini.normalizeKey(key)]; !ok {
 		return false
 	}
 	return true
 }
 
-// Unsafe version of Set
-func (ini *Ini) set(section, key, value string) {
-	if _, ok := ini.data[section]; !ok {
-		ini.data[section] = make(map[string]string)
+// SetSortKeys() makes WriteTo() emit sections and keys in alphabetical order.
+// The "" section is still written first.
+func (ini *Ini) SetSortKeys(sorted bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.sortKeys = sorted
+}
+
+// SetPreserveFormatting() makes WriteTo() reproduce the blank lines read by
+// ReadFrom() in front of section headers and keys.
+func (ini *Ini) SetPreserveFormatting(preserve bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.preserveFormatting = preserve
+}
+
+// SetUnescape() makes ReadFrom() interpret the escape sequences \n, \r, \t, \\
+// and \" found in unquoted values. WriteTo() escapes them back. Quoted values,
+// as WriteTo() writes the values with surrounding spaces, are unescaped too.
+func (ini *Ini) SetUnescape(unescape bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.unescape = unescape
+}
+
+// SetUnescapeQuoted() makes ReadFrom() interpret the escape sequences \n, \r,
+// \t, \\ and \" found in double-quoted values, which are otherwise kept as is
+// but for \n. A quoted `"say \"hi\""` is then read as `say "hi"`. WriteTo()
+// escapes them back.
+func (ini *Ini) SetUnescapeQuoted(unescape bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.unescapeQuoted = unescape
+}
+
+// SetGlobalSection() controls how WriteTo() emits the keys that are not in a
+// section. When label is not empty, they are written under a [label] header.
+// When last is true, they are written after every other section, labeled
+// "DEFAULT" unless another label is given so that they are not read back as
+// part of the preceding section. SetGlobalSectionAlias() with the same label
+// reads them back into the "" section.
+func (ini *Ini) SetGlobalSection(label string, last bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.globalLabel = label
+	ini.globalLast = last
+}
+
+// SetDisallowEmptyValues() makes ReadFrom() fail on keys without a value, such
+// as "unserialize_callback_func =".
+func (ini *Ini) SetDisallowEmptyValues(disallow bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.disallowEmpty = disallow
+}
+
+// SetGlobalSectionAlias() makes ReadFrom() store the keys of the sections
+// named name, such as "global", in the "" section. An empty "[]" header always
+// stands for the "" section.
+func (ini *Ini) SetGlobalSectionAlias(name string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.globalAlias = name
+}
+
+// SetCommentPrefixes() sets the prefixes starting a comment line, ";" and
+// "#" by default. A prefix may be longer than one character, such as "//".
+// Calling it without prefixes disables comments.
+func (ini *Ini) SetCommentPrefixes(prefixes ...string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.commentPrefixes = prefixes
+}
+
+// SetMergeDuplicateSections() controls what ReadFrom() does when a section
+// header appears twice in the input. By default the keys of both occurrences
+// are merged in the same section; when merge is false, it is an error.
+func (ini *Ini) SetMergeDuplicateSections(merge bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.mergeDuplicates = merge
+}
+
+// SetSectionSeparator() sets the separator ParseSectionName() splits section
+// names on, ":" by default.
+func (ini *Ini) SetSectionSeparator(separator string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.sectionSeparator = separator
+}
+
+// SetAllowBareKeys() makes ReadFrom() accept keys without a '=' delimiter,
+// such as a standalone "verbose" line. They are stored with an empty value.
+func (ini *Ini) SetAllowBareKeys(allow bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.allowBareKeys = allow
+}
+
+// SetAllowIncludes() makes ReadFrom() process "@include path" lines by reading
+// the file at path on top of the current data. Relative paths are resolved
+// from baseDir. An empty baseDir disables includes.
+func (ini *Ini) SetAllowIncludes(baseDir string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.includeDir = baseDir
+}
+
+// SetTrimValues() controls whether ReadFrom() removes the spaces surrounding
+// unquoted values, which it does by default. Disabling it keeps the values of
+// fixed-width configurations intact.
+func (ini *Ini) SetTrimValues(trim bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.trimValues = trim
+}
+
+// SetWriteEmptySections() makes WriteTo() emit a bare header for the sections
+// holding no key instead of skipping them.
+func (ini *Ini) SetWriteEmptySections(write bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.writeEmptySections = write
+}
+
+// SetAllowGlobalKeys() controls whether ReadFrom() accepts keys before the
+// first section header, which it does by default.
+func (ini *Ini) SetAllowGlobalKeys(allow bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.allowGlobalKeys = allow
+}
+
+// SetArrayKeys() makes ReadFrom() recognize the PHP style "key[] = value"
+// syntax: the values of the repeated key[] lines are appended to key and can be
+// retrieved with GetAll(). WriteTo() then writes multi-valued keys that way.
+func (ini *Ini) SetArrayKeys(array bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.arrayKeys = array
+}
+
+// SetIndent() sets the string WriteTo() writes in front of each key of a
+// section, such as two spaces. The keys of the "" section are not indented.
+func (ini *Ini) SetIndent(indent string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.indent = indent
+}
+
+// SetDelimiterSpacing() sets the delimiter WriteTo() writes between keys and
+// values. It defaults to "" for a tight "key=value", and " = " writes the
+// common "key = value" style. A non-empty delimiter must be a '=' surrounded
+// by spaces or tabs, otherwise WriteTo() returns an error.
+func (ini *Ini) SetDelimiterSpacing(delimiter string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.delimiter = delimiter
+}
+
+// SetHeader() sets a comment WriteTo() writes at the top of the output, such
+// as a "DO NOT EDIT" banner, one comment line per line of header. It is
+// separated from the configuration by a blank line. No header is written when
+// comments are disabled by SetCommentPrefixes().
+func (ini *Ini) SetHeader(header string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.header = header
+}
+
+// SetLineEnding() sets the line terminator WriteTo() writes, such as "\r\n"
+// for Windows consumers. It defaults to "\n".
+func (ini *Ini) SetLineEnding(eol string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.lineEnding = eol
+}
+
+// SetMaxValueLength() makes ReadFrom() fail on values longer than max bytes.
+// Zero, the default, means unlimited.
+func (ini *Ini) SetMaxValueLength(max int) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.maxValueLength = max
+}
+
+// SetMaxLineLength() makes ReadFrom() fail on lines longer than max
+// characters, whether they hold a key, a section header or a comment. Lines
+// are checked as they are read, so that a longer line is never read whole.
+// Zero, the default, means unlimited.
+func (ini *Ini) SetMaxLineLength(max int) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.maxLineLength = max
+}
+
+// SetMaxEntries() makes ReadFrom() fail when the input holds more than max
+// keys. Zero, the default, means unlimited.
+func (ini *Ini) SetMaxEntries(max int) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.maxEntries = max
+}
+
+// SetLowercaseKeys() makes keys case-insensitive by lowercasing them when they
+// are stored and looked up, as git does for variable names. Section names are
+// left untouched. It applies to the keys set afterwards.
+func (ini *Ini) SetLowercaseKeys(lowercase bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.lowercaseKeys = lowercase
+}
+
+// SetKeyNormalizer() sets a function transforming keys when they are stored
+// and looked up, such as one replacing spaces with underscores. It applies
+// after SetLowercaseKeys() and to the keys set afterwards. It must be
+// idempotent, as stored keys, such as the ones returned by Keys(), are
+// normalized again when they are passed back. A nil normalizer disables it.
+func (ini *Ini) SetKeyNormalizer(normalize func(string) string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.keyNormalizer = normalize
+}
+
+// Unsafe version of Set, key being already normalized.
+func (ini *Ini) set(section, key, value string) {
+	ini.addSection(section)
+	if _, ok := ini.data[section][key]; !ok {
+		ini.keys[section] = append(ini.keys[section], key)
+	}
+	ini.data[section][key] = value
+	delete(ini.multi[section], key)
+	if l, ok := ini.keyLayouts[section][key]; ok {
+		l.raw = ""
+	}
+}
+
+// normalizeKey returns key as it is stored.
+func (ini *Ini) normalizeKey(key string) string {
+	if ini.lowercaseKeys {
+		key = strings.ToLower(key)
+	}
+	if ini.keyNormalizer != nil {
+		key = ini.keyNormalizer(key)
+	}
+	return key
+}
+
+// Unsafe version of AddSection
+func (ini *Ini) addSection(section string) {
+	if _, ok := ini.data[section]; !ok {
+		ini.data[section] = make(map[string]string)
+		ini.sections = append(ini.sections, section)
+	}
+}
+
+// Unsafe version of AppendValue, key being already normalized.
+func (ini *Ini) appendValue(section, key, value string) {
+	values := ini.valuesOf(section, key)
+	ini.set(section, key, value)
+	if _, ok := ini.multi[section]; !ok {
+		ini.multi[section] = make(map[string][]string)
+	}
+	ini.multi[section][key] = append(values, value)
+}
+
+// deleteKey removes the stored key from section along with its ordering and
+// layout.
+func (ini *Ini) deleteKey(section, key string) {
+	if _, ok := ini.data[section][key]; !ok {
+		return
+	}
+	delete(ini.data[section], key)
+	delete(ini.multi[section], key)
+	delete(ini.keyLayouts[section], key)
+	keys := ini.keys[section]
+	for i := range keys {
+		if keys[i] == key {
+			ini.keys[section] = append(keys[:i:i], keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// valuesOf returns a copy of every value of the stored key in section.
+func (ini *Ini) valuesOf(section, key string) []string {
+	if values, ok := ini.multi[section][key]; ok {
+		return append([]string(nil), values...)
+	}
+	if value, ok := ini.data[section][key]; ok {
+		return []string{value}
+	}
+	return nil
+}
+
+// clear removes every section and key along with their ordering and layout.
+func (ini *Ini) clear() {
+	ini.data = make(map[string]map[string]string)
+	ini.sections = nil
+	ini.keys = make(map[string][]string)
+	ini.multi = make(map[string]map[string][]string)
+	ini.sectionLayouts = make(map[string]*layout)
+	ini.keyLayouts = make(map[string]map[string]*layout)
+}
+
+// PrefixSections() renames every section to prefix followed by its name, so
+// that ini can be merged as a sub-tree of another configuration. The keys of
+// the "" section move to the section named prefix.
+func (ini *Ini) PrefixSections(prefix string) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	// The maps are rebuilt rather than sections moved one by one, as a
+	// renamed section may collide with one not renamed yet.
+	ini.data = prefixKeys(ini.data, prefix)
+	ini.keys = prefixKeys(ini.keys, prefix)
+	ini.multi = prefixKeys(ini.multi, prefix)
+	ini.sectionLayouts = prefixKeys(ini.sectionLayouts, prefix)
+	ini.keyLayouts = prefixKeys(ini.keyLayouts, prefix)
+	for i := range ini.sections {
+		ini.sections[i] = prefix + ini.sections[i]
+	}
+}
+
+// prefixKeys returns a copy of m with prefix added in front of every key.
+func prefixKeys[V any](m map[string]V, prefix string) map[string]V {
+	prefixed := make(map[string]V, len(m))
+	for k, v := range m {
+		prefixed[prefix+k] = v
+	}
+	return prefixed
+}
+
+// moveSection renames section old to new along with its ordering and layout.
+func (ini *Ini) moveSection(old, new string) {
+	ini.data[new] = ini.data[old]
+	ini.keys[new] = ini.keys[old]
+	delete(ini.data, old)
+	delete(ini.keys, old)
+	if m, ok := ini.multi[old]; ok {
+		ini.multi[new] = m
+		delete(ini.multi, old)
+	}
+	if l, ok := ini.sectionLayouts[old]; ok {
+		ini.sectionLayouts[new] = l
+		delete(ini.sectionLayouts, old)
+	}
+	if l, ok := ini.keyLayouts[old]; ok {
+		ini.keyLayouts[new] = l
+		delete(ini.keyLayouts, old)
+	}
+	for i := range ini.sections {
+		if ini.sections[i] == old {
+			ini.sections[i] = new
+		}
+	}
+}
+
+// keyLayout returns the layout of key in section, creating it if needed.
+func (ini *Ini) keyLayout(section, key string) *layout {
+	if _, ok := ini.keyLayouts[section]; !ok {
+		ini.keyLayouts[section] = make(map[string]*layout)
+	}
+	if _, ok := ini.keyLayouts[section][key]; !ok {
+		ini.keyLayouts[section][key] = new(layout)
+	}
+	return ini.keyLayouts[section][key]
+}
+
+// ReadFrom() read the ini configuration contained in the Reader r until EOF.
+func (ini *Ini) ReadFrom(r io.Reader) (int64, error) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	return ini.read(r)
+}
+
+// MergeReader() reads the ini configuration contained in the Reader r on top
+// of the current data, overwriting the keys already set.
+func (ini *Ini) MergeReader(r io.Reader) (int64, error) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	return ini.read(r)
+}
+
+// ReloadFrom() replaces the configuration with the one contained in the Reader
+// r. ini is locked while r is read, so that it is never seen half loaded. On
+// error, the previous configuration is left untouched.
+func (ini *Ini) ReloadFrom(r io.Reader) error {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	data, sections, keys, multi := ini.data, ini.sections, ini.keys, ini.multi
+	sectionLayouts, keyLayouts := ini.sectionLayouts, ini.keyLayouts
+	ini.clear()
+	if _, err := ini.read(r); err != nil {
+		ini.data, ini.sections, ini.keys, ini.multi = data, sections, keys, multi
+		ini.sectionLayouts, ini.keyLayouts = sectionLayouts, keyLayouts
+		return err
+	}
+	return nil
+}
+
+// Warning is a minor issue found by ReadFromWithWarnings().
+type Warning struct {
+	Line    int
+	Message string
+}
+
+// ReadFromWithWarnings() is like ReadFrom() but does not fail on minor issues.
+// Lines without a '=' are ignored and keys set more than once keep their last
+// value, and both are reported as warnings.
+func (ini *Ini) ReadFromWithWarnings(r io.Reader) ([]Warning, error) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	var warnings []Warning
+	ini.warn = func(w Warning) {
+		warnings = append(warnings, w)
+	}
+	defer func() {
+		ini.warn = nil
+	}()
+
+	seen := make(map[string]map[string]bool)
+	_, err := ini.readWith(r, func(it *item) error {
+		if !it.isSection && !it.appended {
+			if seen[it.section] == nil {
+				seen[it.section] = make(map[string]bool)
+			}
+			key := ini.normalizeKey(it.key)
+			if seen[it.section][key] {
+				ini.warn(Warning{Line: it.line, Message: fmt.Sprintf("Duplicate key %q in section %q", it.key, it.section)})
+			}
+			seen[it.section][key] = true
+		}
+		return ini.store(it)
+	})
+	return warnings, err
+}
+
+// Parse() reads the ini configuration contained in the Reader r and calls fn
+// for every key as soon as it is read, without storing anything. Parse()
+// stops and returns the error returned by fn, if any.
+func Parse(r io.Reader, fn func(section, key, value string) error) error {
+	_, err := NewIni().parse(r, make(map[string]bool), func(it *item) error {
+		if it.isSection {
+			return nil
+		}
+		return fn(it.section, it.key, it.value)
+	})
+	return err
+}
+
+// ReadSection() reads the ini configuration contained in the Reader r and
+// returns the keys of section only. The keys of other sections are read but
+// not stored.
+func ReadSection(r io.Reader, section string) (map[string]string, error) {
+	values := make(map[string]string)
+	_, err := NewIni().parse(r, make(map[string]bool), func(it *item) error {
+		if !it.isSection && it.section == section {
+			values[it.key] = it.value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// sectionName returns the section a header named name read at pos stands
+// for. seen holds the sections read so far, for duplicates to be detected.
+func (ini *Ini) sectionName(name, pos string, seen map[string]bool) (string, error) {
+	if ini.globalAlias != "" && name == ini.globalAlias {
+		name = ""
+	}
+	if !ini.mergeDuplicates && seen[name] {
+		return "", fmt.Errorf("While reading a section, got duplicate section %q. %s", name, pos)
+	}
+	seen[name] = true
+	return name, nil
+}
+
+// checkSectionEnd returns an error if rest, found after the closing bracket of
+// a section header read at pos, is neither blank nor a comment.
+func (ini *Ini) checkSectionEnd(rest, pos string) error {
+	rest = strings.TrimSpace(rest)
+	if _, isComment := ini.commentText(rest); rest != "" && !isComment {
+		return fmt.Errorf("While reading a section, got %q after ']'. %s", rest, pos)
+	}
+	return nil
+}
+
+// keyItem returns the item of a key read by parse, once environment variables
+// are expanded in value and the array suffix of key is handled.
+func (ini *Ini) keyItem(section, key, value string, l layout, line int) *item {
+	if strings.Index(value, "${") != -1 {
+		for _, match := range envvarRegexp.FindAllString(value, -1) {
+			value = strings.Replace(value, match, os.Getenv(match[2:len(match)-1]), -1)
+		}
+	}
+	appended := ini.arrayKeys && strings.HasSuffix(key, arrayKeySuffix)
+	if appended {
+		key = strings.TrimSuffix(key, arrayKeySuffix)
+	}
+	return &item{section: section, key: key, value: value, appended: appended, layout: l, line: line}
+}
+
+// item is a section header or a key read by parse.
+type item struct {
+	isSection bool
+	section   string
+	key       string
+	value     string
+	appended  bool // whether the value is appended to the key's values
+	layout    layout
+	line      int // line number of the section header or key
+}
+
+// Unsafe version of ReadFrom
+func (ini *Ini) read(r io.Reader) (int64, error) {
+	return ini.readWith(r, ini.store)
+}
+
+// readWith parses r and calls store for every item, up to the entry limit.
+func (ini *Ini) readWith(r io.Reader, store func(*item) error) (int64, error) {
+	if ini.maxEntries <= 0 {
+		return ini.parse(r, make(map[string]bool), store)
+	}
+
+	entries := 0
+	return ini.parse(r, make(map[string]bool), func(it *item) error {
+		if !it.isSection {
+			if entries++; entries > ini.maxEntries {
+				return fmt.Errorf("While reading key %q, got more than %d entries", it.key, ini.maxEntries)
+			}
+		}
+		return store(it)
+	})
+}
+
+// store saves an item read by parse.
+func (ini *Ini) store(it *item) error {
+	if it.isSection {
+		if _, ok := ini.sectionLayouts[it.section]; !ok {
+			l := it.layout
+			ini.sectionLayouts[it.section] = &l
+		}
+		ini.addSection(it.section)
+		return nil
+	}
+	key := ini.normalizeKey(it.key)
+	if it.appended {
+		ini.appendValue(it.section, key, it.value)
+	} else {
+		ini.set(it.section, key, it.value)
+	}
+	*ini.keyLayout(it.section, key) = it.layout
+	return nil
+}
+
+// parse reads r and calls handle for every section header and key.
+// included holds the files being included so that include cycles are detected.
+func (ini *Ini) parse(r io.Reader, included map[string]bool, handle func(*item) error) (int64, error) {
+	if ini.lineParser {
+		return ini.parseLines(r, included, handle)
 	}
-	ini.data[section][key] = value
+	return ini.scan(r, included, handle)
 }
 
-// ReadFrom() read the ini configuration contained in the Reader r until EOF.
-func (ini *Ini) ReadFrom(r io.Reader) (int64, error) {
-	ini.rw.Lock()
-	defer ini.rw.Unlock()
-
+// scan is the text/scanner based implementation of parse.
+func (ini *Ini) scan(r io.Reader, included map[string]bool, handle func(*item) error) (int64, error) {
 	s := new(scanner.Scanner).Init(r)
-	s.Mode = scanner.ScanStrings
-	s.Whitespace = 1 << '\t'
+	// Quoted values are read by readQuoted rather than scanned as strings, so
+	// that the length limits apply while they are read.
+	s.Mode = 0
+	// Whitespace is handled by the readers so that tabs in values are kept.
+	s.Whitespace = 0
+	var scanErr error // first error reported by s
+	s.Error = func(s *scanner.Scanner, msg string) {
+		// NUL characters are kept as is, as the line parser does.
+		if msg != "invalid character NUL" && scanErr == nil {
+			scanErr = fmt.Errorf("While reading, got %s. %s", msg, s.Pos().String())
+		}
+	}
 
 	currentSection := ""
+	blankLines := 0
+	var comments []string         // comment lines preceding the current line
+	lead := ""                    // start of a key consumed while looking for a comment prefix
+	seen := make(map[string]bool) // section headers read so far
 	for {
 		token := s.Peek()
+		if scanErr != nil {
+			return -1, scanErr
+		}
 		switch {
 		case token == scanner.EOF:
 			return 0, nil
-		case token == tokenCommentClassic || token == tokenCommentHash:
-			ini.readCommentLine(s)
-			break
-		case token == '\n' || token == '\r':
+		case token == tokenSpace || token == tokenTab:
+			// Indentation, which may precede a comment.
 			s.Scan()
 			break
+		case token == tokenDirective && ini.includeDir != "":
+			if err := ini.readDirective(s, included, handle); err != nil {
+				return -1, err
+			}
+			break
+		case token == tokenLF || token == tokenCR:
+			isLineEnd(s, s.Scan())
+			blankLines++
+			comments = nil
+			break
 		case token == tokenSectionStart:
-			var err error
-			currentSection, err = ini.readSection(s)
+			pos := s.Pos()
+			name, err := ini.readSection(s)
 			if err != nil {
 				return -1, err
 			}
-			break
-		default:
-			key, err := ini.readKey(s)
+			if currentSection, err = ini.sectionName(name, pos.String(), seen); err != nil {
+				return -1, err
+			}
+			if scanErr != nil {
+				return -1, scanErr
+			}
+			err = handle(&item{isSection: true, section: currentSection, layout: layout{blankLines: blankLines}, line: pos.Line})
 			if err != nil {
 				return -1, err
 			}
-			value, err := ini.readValue(s)
+			blankLines = 0
+			comments = nil
+			break
+		case ini.isCommentStart(token):
+			var isComment bool
+			if lead, isComment = ini.readCommentPrefix(s); isComment {
+				comment, err := ini.readComment(s)
+				if err != nil {
+					return -1, err
+				}
+				comments = append(comments, comment)
+				break
+			}
+			// Only the start of a longer prefix such as "//", the line is a key.
+			fallthrough
+		default:
+			pos := s.Pos()
+			key, delimited, err := ini.readKey(s, lead)
+			lead = ""
 			if err != nil {
 				return -1, err
 			}
-			if strings.Index(value, "${") != -1 {
-				fmt.Println("got it")
-				for _, match := range envvarRegexp.FindAllString(value, -1) {
-
-					value = strings.Replace(value, match, os.Getenv(match[2:len(match)-1]), -1)
+			if !delimited && !ini.allowBareKeys {
+				// Bare keys are only returned by readKey when reading with warnings.
+				ini.warn(Warning{Line: pos.Line, Message: fmt.Sprintf("Ignored line %q without '='", key)})
+				comments = nil
+				blankLines = 0
+				break
+			}
+			if currentSection == "" && !ini.allowGlobalKeys {
+				return -1, fmt.Errorf("While reading a key, got %q outside any section. %s", key, pos.String())
+			}
+			value, l := "", layout{}
+			if delimited {
+				value, l, err = ini.readValue(s)
+				if err != nil {
+					return -1, err
 				}
 			}
-			ini.set(currentSection, key, value)
+			if value == "" && ini.disallowEmpty {
+				return -1, fmt.Errorf("While reading a value, got an empty value for %q. %s", key, pos.String())
+			}
+			l.blankLines, l.comment = blankLines, strings.Join(comments, "\n")
+			if scanErr != nil {
+				return -1, scanErr
+			}
+			err = handle(ini.keyItem(currentSection, key, value, l, pos.Line))
+			if err != nil {
+				return -1, err
+			}
+			blankLines = 0
+			comments = nil
 			break
 		}
 	}
@@ -140,48 +1381,288 @@ func (ini *Ini) ReadFrom(r io.Reader) (int64, error) {
 	panic("unreachable")
 }
 
+// Quoting controls which values EncodeTo() quotes.
+type Quoting int
+
+const (
+	// QuoteNeeded quotes the values that would not be read back identically otherwise.
+	QuoteNeeded Quoting = iota
+	// QuoteOriginal also quotes the values that were quoted when read.
+	QuoteOriginal
+	// QuoteAll quotes every value.
+	QuoteAll
+)
+
+// EncodeOptions configures how EncodeTo() writes the configuration.
+type EncodeOptions struct {
+	Quoting    Quoting
+	Delimiter  string // written between keys and values, "=" when empty
+	Indent     string // written in front of the keys of a section
+	Sort       bool   // whether sections and keys are sorted alphabetically
+	LineEnding string // written at the end of each line, "\n" when empty
+}
+
 // WriteTo() writes the configuration in an ini format to the Writer writer.
 func (ini *Ini) WriteTo(writer io.Writer) (int64, error) {
 	ini.rw.RLock()
 	defer ini.rw.RUnlock()
+
+	return ini.encode(writer, ini.writeOptions())
+}
+
+// WriteSection() is like WriteTo() but only writes section, its header and
+// its keys. It returns an error if section does not exist.
+func (ini *Ini) WriteSection(writer io.Writer, section string) (int64, error) {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	if _, ok := ini.data[section]; !ok {
+		return 0, fmt.Errorf("Section %q does not exist", section)
+	}
+	opts := ini.writeOptions().withDefaults()
+	if err := opts.check(); err != nil {
+		return 0, err
+	}
+	return ini.encodeSection(writer, section, opts)
+}
+
+// writeOptions returns the options WriteTo() encodes with.
+func (ini *Ini) writeOptions() EncodeOptions {
+	return EncodeOptions{
+		Quoting:    QuoteOriginal,
+		Delimiter:  ini.delimiter,
+		Indent:     ini.indent,
+		Sort:       ini.sortKeys,
+		LineEnding: ini.lineEnding,
+	}
+}
+
+// withDefaults returns opts with the default delimiter and line ending set if
+// they are empty.
+func (opts EncodeOptions) withDefaults() EncodeOptions {
+	if opts.Delimiter == "" {
+		opts.Delimiter = "="
+	}
+	if opts.LineEnding == "" {
+		opts.LineEnding = "\n"
+	}
+	return opts
+}
+
+// check returns an error if the output written with opts would not be read
+// back, the delimiter being something else than a '=' and blanks.
+func (opts EncodeOptions) check() error {
+	if strings.Trim(opts.Delimiter, " \t") != "=" {
+		return fmt.Errorf("Delimiter %q is not a '=' surrounded by spaces or tabs", opts.Delimiter)
+	}
+	return nil
+}
+
+// EncodeTo() writes the configuration in an ini format to the Writer writer
+// as configured by opts, which take precedence over the quoting, delimiter,
+// indent, sorting and line ending settings of ini. It returns an error if the
+// Delimiter is not a '=' surrounded by spaces or tabs.
+func (ini *Ini) EncodeTo(writer io.Writer, opts EncodeOptions) (int64, error) {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	return ini.encode(writer, opts)
+}
+
+// Unsafe version of EncodeTo
+func (ini *Ini) encode(writer io.Writer, opts EncodeOptions) (int64, error) {
 	var nw int64
+	opts = opts.withDefaults()
+	if err := opts.check(); err != nil {
+		return 0, err
+	}
 
-	// Starting with the "" section
+	if header := ini.formatComment(&layout{comment: ini.header}, "", opts.LineEnding); header != "" {
+		n, err := fmt.Fprintf(writer, "%s%s", header, opts.LineEnding)
+		nw = nw + int64(n)
+		if err != nil {
+			return nw, err
+		}
+	}
 
-	if data, ok := ini.data[""]; ok {
-		for k := range data {
-			n, err := fmt.Fprintf(writer, "%s=%q\n", k, data[k])
-			nw = nw + int64(n)
-			if err != nil {
-				return nw, err
-			}
+	for _, section := range ini.sectionNames(opts.Sort) {
+		n, err := ini.encodeSection(writer, section, opts)
+		nw = nw + n
+		if err != nil {
+			return nw, err
 		}
 	}
+	return nw, nil
+}
 
-	for section := range ini.data {
-		if section == "" {
-			continue
+// encodeSection writes the header and the keys of section. The delimiter and
+// line ending of opts must be set.
+func (ini *Ini) encodeSection(writer io.Writer, section string, opts EncodeOptions) (int64, error) {
+	var nw int64
+	eol := opts.LineEnding
+	keys := ini.keyNames(section, opts.Sort)
+	header := section
+	if section == "" {
+		header = ini.globalHeader()
+	}
+	if header != "" && (len(keys) > 0 || ini.writeEmptySections) {
+		n, err := fmt.Fprintf(writer, "%s[%s]%s", ini.blankLines(ini.sectionLayouts[section], eol), header, eol)
+		nw = nw + int64(n)
+		if err != nil {
+			return nw, err
 		}
-		index := 0
-		for k := range ini.data[section] {
-			if index == 0 {
-				n, err := fmt.Fprintf(writer, "[%s]\n", section)
-				nw = nw + int64(n)
-				if err != nil {
-					return nw, err
-				}
+	}
+	indent := opts.Indent
+	if section == "" {
+		indent = ""
+	}
+	for _, k := range keys {
+		l := ini.keyLayouts[section][k]
+		n, err := fmt.Fprintf(writer, "%s%s", ini.blankLines(l, eol), ini.formatComment(l, indent, eol))
+		nw = nw + int64(n)
+		if err != nil {
+			return nw, err
+		}
+		values := ini.valuesOf(section, k)
+		name := k
+		if ini.arrayKeys && len(values) > 1 {
+			name += arrayKeySuffix
+		}
+		quoted := opts.Quoting == QuoteAll || (opts.Quoting == QuoteOriginal && l != nil && l.quoted)
+		for i, value := range values {
+			inline := ""
+			if i == len(values)-1 {
+				inline = ini.formatInlineComment(l)
 			}
-			n, err := fmt.Fprintf(writer, "%s=%q\n", k, ini.data[section][k])
+			// An empty value followed by a comment is quoted, so that the
+			// comment is not read back as the value.
+			formatted := ini.formatValue(value, quoted || (value == "" && inline != ""))
+			n, err := fmt.Fprintf(writer, "%s%s%s%s%s%s", indent, name, opts.Delimiter, formatted, inline, eol)
 			nw = nw + int64(n)
 			if err != nil {
 				return nw, err
 			}
-			index++
 		}
 	}
 	return nw, nil
 }
 
+// globalHeader returns the header under which the "" section is written.
+func (ini *Ini) globalHeader() string {
+	if ini.globalLabel == "" && ini.globalLast {
+		return "DEFAULT"
+	}
+	return ini.globalLabel
+}
+
+// blankLines returns the blank lines to write in front of a line with layout l.
+func (ini *Ini) blankLines(l *layout, eol string) string {
+	if !ini.preserveFormatting || l == nil {
+		return ""
+	}
+	return strings.Repeat(eol, l.blankLines)
+}
+
+// formatComment returns the comment lines to write in front of a line with
+// layout l, using the first comment prefix.
+func (ini *Ini) formatComment(l *layout, indent, eol string) string {
+	prefix := ini.commentPrefix()
+	if l == nil || l.comment == "" || prefix == "" {
+		return ""
+	}
+	buffer := new(bytes.Buffer)
+	for _, line := range strings.Split(l.comment, "\n") {
+		if line == "" {
+			fmt.Fprintf(buffer, "%s%s%s", indent, prefix, eol)
+		} else {
+			fmt.Fprintf(buffer, "%s%s %s%s", indent, prefix, line, eol)
+		}
+	}
+	return buffer.String()
+}
+
+// commentPrefix returns the prefix of the comments written by WriteTo(), the
+// first configured one, or "" if comments are disabled and none is written.
+func (ini *Ini) commentPrefix() string {
+	if len(ini.commentPrefixes) > 0 {
+		return ini.commentPrefixes[0]
+	}
+	return ""
+}
+
+// formatInlineComment returns the comment to write after the value of a key,
+// preceded by a space and the comment prefix.
+func (ini *Ini) formatInlineComment(l *layout) string {
+	if l == nil || l.inline == "" || ini.commentPrefix() == "" {
+		return ""
+	}
+	return " " + ini.commentPrefix() + " " + l.inline
+}
+
+// formatValue returns value as it must be written. The value is quoted if it
+// was quoted when read, or when reading it back bare would alter it.
+func (ini *Ini) formatValue(value string, quoted bool) string {
+	bare, special := value, "\"=\r\n"
+	if ini.unescape {
+		// Quotes and control characters are escaped and can be written bare.
+		bare, special = escapeReplacer.Replace(value), "="
+	}
+	if quoted || bare != strings.TrimSpace(bare) || strings.ContainsAny(bare, special) ||
+		ini.containsCommentPrefix(bare) {
+		if ini.unescape || ini.unescapeQuoted {
+			return `"` + escapeReplacer.Replace(value) + `"`
+		}
+		return `"` + encodeNewlines(value) + `"`
+	}
+	return bare
+}
+
+// sectionNames returns the section names in the order they must be written.
+// The "" section comes first unless it is configured to come last.
+func (ini *Ini) sectionNames(sorted bool) []string {
+	names := make([]string, 0, len(ini.sections))
+	for _, section := range ini.sections {
+		if section != "" {
+			names = append(names, section)
+		}
+	}
+	if sorted {
+		sort.Strings(names)
+	}
+	if _, ok := ini.data[""]; ok {
+		if ini.globalLast {
+			names = append(names, "")
+		} else {
+			names = append([]string{""}, names...)
+		}
+	}
+	return names
+}
+
+// keyNames returns the keys of section in the order they must be written.
+func (ini *Ini) keyNames(section string, sorted bool) []string {
+	keys := append([]string(nil), ini.keys[section]...)
+	if sorted {
+		sort.Strings(keys)
+	}
+	return keys
+}
+
+// sortedKeys returns the keys of m in alphabetical order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readSection reads a section header. The section name is trimmed of its
+// surrounding whitespace, internal spaces being preserved. Anything following
+// the closing bracket on the same line, such as "; production" in
+// "[database] ; production", is treated as a comment and ignored. Anything else
+// is an error.
 func (ini *Ini) readSection(s *scanner.Scanner) (string, error) {
 	buffer := new(bytes.Buffer)
 	for {
@@ -191,71 +1672,455 @@ func (ini *Ini) readSection(s *scanner.Scanner) (string, error) {
 		case token == tokenSectionStart:
 			break
 		case token == tokenSectionStop:
-			return buffer.String(), nil
+			rest, err := ini.readLine(s)
+			if err != nil {
+				return "", err
+			}
+			if err := ini.checkSectionEnd(rest, pos.String()); err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(buffer.String()), nil
+		case token == scanner.EOF:
+			return "", fmt.Errorf("While reading a section, got EOF. %s", pos.String())
 		case token == '\n' || token == '\r':
 			return "", fmt.Errorf("While reading a section, got newline. %s", pos.String())
 		default:
 			buffer.WriteRune(token)
 			break
 		}
+		if err := ini.checkLineLength(s, "section"); err != nil {
+			return "", err
+		}
 	}
 	return buffer.String(), nil
 }
 
-func (ini *Ini) readValue(s *scanner.Scanner) (string, error) {
-	buffer := new(bytes.Buffer)
+// readValue reads a value up to the end of the line. The returned layout tells
+// whether the value is quoted, and holds its raw text and the inline comment
+// following it, if any.
+func (ini *Ini) readValue(s *scanner.Scanner) (string, layout, error) {
+	buffer, raw := new(bytes.Buffer), new(bytes.Buffer)
+	blanks := 0 // spaces and tabs read literally at the end of buffer
 	for {
+		if ini.isCommentStart(s.Peek()) && isBlankEnded(buffer.String()) {
+			lead, isComment := ini.readCommentPrefix(s)
+			if isComment {
+				inline, err := ini.readComment(s)
+				if err != nil {
+					return "", layout{}, err
+				}
+				l := layout{raw: ini.trimValue(raw.String()), inline: inline}
+				return ini.trimBlanks(buffer.String(), blanks), l, nil
+			}
+			buffer.WriteString(lead)
+			raw.WriteString(lead)
+			blanks = 0
+			continue
+		}
+		if s.Peek() == '"' {
+			text, err := ini.readQuoted(s)
+			if err != nil {
+				return "", layout{}, err
+			}
+			inline, err := ini.skipInlineComment(s)
+			if err != nil {
+				return "", layout{}, err
+			}
+			l, value := layout{quoted: true, raw: text, inline: inline}, text[1:len(text)-1]
+			if ini.unescape || ini.unescapeQuoted {
+				return decodeEscapes(value), l, nil
+			}
+			return decodeNewlines(value), l, nil
+		}
 		token := s.Scan()
 		switch {
 		case token == scanner.EOF:
-			return buffer.String(), nil
-		case token == scanner.String:
-			value := strings.TrimRight(strings.TrimLeft(s.TokenText(), "\""), "\"")
-			return value, nil
-		case token == tokenLF:
-			return buffer.String(), nil
-		case token == tokenCR:
-			break
-		case token == tokenSpace:
-			if buffer.Len() == 0 {
+			return ini.trimBlanks(buffer.String(), blanks), layout{raw: ini.trimValue(raw.String())}, nil
+		case isLineEnd(s, token):
+			return ini.trimBlanks(buffer.String(), blanks), layout{raw: ini.trimValue(raw.String())}, nil
+		case token == tokenSpace || token == tokenTab:
+			if buffer.Len() == 0 && ini.trimValues {
 				break
 			}
 			buffer.WriteRune(token)
+			raw.WriteRune(token)
+			blanks++
+		case token == tokenEscape && ini.unescape:
+			raw.WriteRune(token)
+			if escaped, ok := ini.readEscape(s, buffer); ok {
+				raw.WriteRune(escaped)
+			}
+			blanks = 0
 		default:
 			buffer.WriteRune(token)
+			raw.WriteRune(token)
+			blanks = 0
+		}
+		if err := ini.checkLength(s, buffer.Len()); err != nil {
+			return "", layout{}, err
 		}
 	}
 
-	return buffer.String(), nil
+	return buffer.String(), layout{raw: raw.String()}, nil
+}
+
+// decodeEscapes replaces the \n, \r, \t, \\ and \" escape sequences of a
+// quoted value with the characters they stand for. Other escape sequences are
+// kept as is.
+func decodeEscapes(value string) string {
+	if !strings.ContainsRune(value, tokenEscape) {
+		return value
+	}
+	buffer := new(bytes.Buffer)
+	for i := 0; i < len(value); i++ {
+		if value[i] != tokenEscape || i+1 == len(value) {
+			buffer.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n':
+			buffer.WriteByte('\n')
+		case 'r':
+			buffer.WriteByte('\r')
+		case 't':
+			buffer.WriteByte('\t')
+		case tokenEscape, '"':
+			buffer.WriteByte(value[i])
+		default:
+			buffer.WriteByte(tokenEscape)
+			buffer.WriteByte(value[i])
+		}
+	}
+	return buffer.String()
+}
+
+// encodeNewlines is the reverse of decodeNewlines: it replaces the newlines of
+// a value to quote with \n escape sequences and keeps other characters, tabs
+// and escape sequences included, as is. Quotes which are not escaped already
+// are escaped so that they do not end the quoted value, and so is a trailing
+// backslash. Such values are not read back identically, SetUnescapeQuoted()
+// escapes them losslessly.
+func encodeNewlines(value string) string {
+	buffer := new(bytes.Buffer)
+	escaped := false
+	for _, r := range value {
+		switch {
+		case r == '\n':
+			buffer.WriteString(`\n`)
+		case r == '"' && !escaped:
+			buffer.WriteString(`\"`)
+		default:
+			buffer.WriteRune(r)
+		}
+		escaped = r == tokenEscape && !escaped
+	}
+	if escaped {
+		buffer.WriteRune(tokenEscape)
+	}
+	return buffer.String()
 }
 
-func (ini *Ini) readKey(s *scanner.Scanner) (string, error) {
+// decodeNewlines replaces the \n escape sequences of a quoted value with
+// newlines. Other escape sequences are kept as is.
+func decodeNewlines(value string) string {
+	if !strings.ContainsRune(value, tokenEscape) {
+		return value
+	}
 	buffer := new(bytes.Buffer)
+	for i := 0; i < len(value); i++ {
+		if value[i] != tokenEscape || i+1 == len(value) {
+			buffer.WriteByte(value[i])
+			continue
+		}
+		i++
+		if value[i] == 'n' {
+			buffer.WriteByte('\n')
+		} else {
+			buffer.WriteByte(tokenEscape)
+			buffer.WriteByte(value[i])
+		}
+	}
+	return buffer.String()
+}
+
+// readQuoted reads a double-quoted value, quotes included, up to its closing
+// quote. Escaped quotes do not close the value.
+func (ini *Ini) readQuoted(s *scanner.Scanner) (string, error) {
+	text := new(bytes.Buffer)
+	text.WriteRune(s.Next())
+	for {
+		token := s.Next()
+		if token == '"' {
+			text.WriteRune(token)
+			return text.String(), nil
+		}
+		if token == tokenEscape {
+			text.WriteRune(token)
+			token = s.Next()
+		}
+		if token == scanner.EOF || token == tokenLF || token == tokenCR {
+			return "", fmt.Errorf("While reading a value, got an unterminated string. %s", s.Pos().String())
+		}
+		text.WriteRune(token)
+		if err := ini.checkLength(s, text.Len()-1); err != nil {
+			return "", err
+		}
+	}
+}
+
+// checkLength returns an error if the value being read, of length bytes so
+// far, or its line exceed the configured limits.
+func (ini *Ini) checkLength(s *scanner.Scanner, length int) error {
+	if err := ini.checkValueLength(length, s.Pos().String()); err != nil {
+		return err
+	}
+	return ini.checkLineLength(s, "value")
+}
+
+// checkLineLength returns an error if the line being read by s, while reading
+// what, exceeds the configured limit.
+func (ini *Ini) checkLineLength(s *scanner.Scanner, what string) error {
+	if ini.maxLineLength > 0 && s.Pos().Column-1 > ini.maxLineLength {
+		return fmt.Errorf("While reading a %s, got a line longer than %d characters. %s", what, ini.maxLineLength, s.Pos().String())
+	}
+	return nil
+}
+
+// checkValueLength returns an error if a value of length bytes read at pos
+// exceeds the configured limit.
+func (ini *Ini) checkValueLength(length int, pos string) error {
+	if ini.maxValueLength > 0 && length > ini.maxValueLength {
+		return fmt.Errorf("While reading a value, got a value longer than %d bytes. %s", ini.maxValueLength, pos)
+	}
+	return nil
+}
+
+// trimValue removes the trailing spaces and tabs of an unquoted value, unless
+// values are not trimmed.
+func (ini *Ini) trimValue(value string) string {
+	if !ini.trimValues {
+		return value
+	}
+	return strings.TrimRight(value, string([]rune{tokenSpace, tokenTab}))
+}
+
+// trimBlanks removes the last blanks bytes of an unescaped value, the spaces
+// and tabs read literally after it, unless values are not trimmed. Unlike
+// trimValue, it keeps the tabs and newlines decoded from escape sequences.
+func (ini *Ini) trimBlanks(value string, blanks int) string {
+	if !ini.trimValues {
+		return value
+	}
+	return value[:len(value)-blanks]
+}
+
+// readEscape writes to buffer the rune escaped by the backslash just scanned.
+// Unknown escape sequences are kept as is. It returns the rune following the
+// backslash and true if it was consumed.
+func (ini *Ini) readEscape(s *scanner.Scanner, buffer *bytes.Buffer) (rune, bool) {
+	switch s.Peek() {
+	case 'n':
+		buffer.WriteRune('\n')
+		return s.Next(), true
+	case 'r':
+		buffer.WriteRune('\r')
+		return s.Next(), true
+	case 't':
+		buffer.WriteRune('\t')
+		return s.Next(), true
+	case tokenEscape, '"':
+		r := s.Next()
+		buffer.WriteRune(r)
+		return r, true
+	default:
+		buffer.WriteRune(tokenEscape)
+		return 0, false
+	}
+}
+
+// readKey reads a key up to the '=' delimiter. Leading and trailing whitespace
+// is trimmed from the key while internal spaces are preserved, so that
+// "  a b  = c" yields the key "a b".
+// The returned bool is false when the key is a bare key ended by a newline or EOF.
+func (ini *Ini) readKey(s *scanner.Scanner, lead string) (string, bool, error) {
+	start := s.Pos()
+	buffer := bytes.NewBufferString(lead)
 	for {
 		pos := s.Pos()
 		token := s.Scan()
 		switch {
+		case token == scanner.EOF && (ini.allowBareKeys || ini.warn != nil):
+			return strings.TrimSpace(buffer.String()), false, nil
 		case token == scanner.EOF:
-			return "", fmt.Errorf("While reading a key, got EOF. %s", pos.String())
-		case token == tokenSpace:
-			break
+			return "", false, fmt.Errorf("While reading a key, got EOF. %s", pos.String())
+		case (ini.allowBareKeys || ini.warn != nil) && isLineEnd(s, token):
+			return strings.TrimSpace(buffer.String()), false, nil
+		case isLineEnd(s, token):
+			return "", false, fmt.Errorf("While reading a key, expected '=' in key line. %s", start.String())
 		case token == '=':
-			return buffer.String(), nil
-		case token == scanner.String:
-			return "", fmt.Errorf("While reading a key, got string. %s", pos.String())
+			return strings.TrimSpace(buffer.String()), true, nil
+		case token == '"':
+			return "", false, fmt.Errorf("While reading a key, got string. %s", pos.String())
 		default:
 			buffer.WriteRune(token)
 		}
+		if ini.maxLineLength > 0 && s.Pos().Column-1 > ini.maxLineLength {
+			return "", false, fmt.Errorf("While reading a key, got a line longer than %d characters. %s", ini.maxLineLength, start.String())
+		}
 	}
 
-	return buffer.String(), nil
+	return buffer.String(), false, nil
+}
+
+// isCommentStart returns true if token is the first character of a comment
+// prefix. The whole prefix is checked by readCommentPrefix.
+func (ini *Ini) isCommentStart(token rune) bool {
+	for _, prefix := range ini.commentPrefixes {
+		if strings.HasPrefix(prefix, string(token)) {
+			return true
+		}
+	}
+	return false
 }
 
-func (ini *Ini) readCommentLine(s *scanner.Scanner) {
+// readCommentPrefix consumes characters as long as they may start a comment
+// prefix and returns true once they form a whole prefix. Otherwise they are
+// the start of a key and are returned with false.
+func (ini *Ini) readCommentPrefix(s *scanner.Scanner) (string, bool) {
+	read := ""
 	for {
-		token := s.Scan()
-		if token == '\n' {
-			return
+		next := read + string(s.Peek())
+		partial := false
+		for _, prefix := range ini.commentPrefixes {
+			if prefix == next {
+				s.Next()
+				return "", true
+			}
+			if strings.HasPrefix(prefix, next) {
+				partial = true
+			}
+		}
+		if !partial {
+			return read, false
+		}
+		read = next
+		s.Next()
+	}
+}
+
+// containsCommentPrefix returns true if value contains a comment prefix.
+func (ini *Ini) containsCommentPrefix(value string) bool {
+	for _, prefix := range ini.commentPrefixes {
+		if strings.Contains(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readDirective reads a directive line and processes it.
+func (ini *Ini) readDirective(s *scanner.Scanner, included map[string]bool, handle func(*item) error) error {
+	pos := s.Pos()
+	line, err := ini.readLine(s)
+	if err != nil {
+		return err
+	}
+	return ini.directive(strings.TrimSpace(line), pos.String(), included, handle)
+}
+
+// directive processes the directive line read at pos.
+func (ini *Ini) directive(line, pos string, included map[string]bool, handle func(*item) error) error {
+	if !strings.HasPrefix(line, directiveInclude+" ") {
+		return fmt.Errorf("While reading a directive, got unknown directive %q. %s", line, pos)
+	}
+
+	path := strings.TrimSpace(strings.TrimPrefix(line, directiveInclude))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(ini.includeDir, path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if included[path] {
+		return fmt.Errorf("While reading a directive, got include cycle on %s. %s", path, pos)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	included[path] = true
+	defer delete(included, path)
+	_, err = ini.parse(f, included, handle)
+	return err
+}
+
+// readLine returns the rest of the current line and consumes its line end.
+func (ini *Ini) readLine(s *scanner.Scanner) (string, error) {
+	buffer := new(bytes.Buffer)
+	for {
+		token := s.Next()
+		if token == scanner.EOF || isLineEnd(s, token) {
+			return buffer.String(), nil
+		}
+		buffer.WriteRune(token)
+		if err := ini.checkLineLength(s, "line"); err != nil {
+			return "", err
+		}
+	}
+}
+
+// readComment reads the rest of a comment line, once its prefix is consumed,
+// and returns its text without the surrounding whitespace.
+func (ini *Ini) readComment(s *scanner.Scanner) (string, error) {
+	line, err := ini.readLine(s)
+	return strings.TrimSpace(line), err
+}
+
+// isBlankEnded returns true if value is not blank and ends with a space or a
+// tab, so that a comment prefix following it starts an inline comment. This
+// keeps values such as "#ff0000" and "http://host/#anchor" intact.
+func isBlankEnded(value string) bool {
+	return strings.TrimSpace(value) != "" && strings.TrimRight(value, " \t") != value
+}
+
+// skipInlineComment consumes the spaces following a quoted value, the inline
+// comment after them if any, and the line end. It returns the comment.
+func (ini *Ini) skipInlineComment(s *scanner.Scanner) (string, error) {
+	for s.Peek() == tokenSpace || s.Peek() == tokenTab {
+		s.Next()
+	}
+	if ini.isCommentStart(s.Peek()) {
+		if _, isComment := ini.readCommentPrefix(s); isComment {
+			return ini.readComment(s)
+		}
+	}
+	skipLineEnd(s)
+	return "", nil
+}
+
+// skipLineEnd consumes the spaces and the line end following a token, if any.
+func skipLineEnd(s *scanner.Scanner) {
+	for s.Peek() == tokenSpace || s.Peek() == tokenTab {
+		s.Next()
+	}
+	if s.Peek() == tokenLF || s.Peek() == tokenCR {
+		isLineEnd(s, s.Next())
+	}
+}
+
+// isLineEnd returns true if token ends a line, be it "\n", "\r" or "\r\n".
+// The "\n" following a "\r" is consumed so that the pair counts as one line end.
+func isLineEnd(s *scanner.Scanner, token rune) bool {
+	if token == tokenCR {
+		if s.Peek() == tokenLF {
+			s.Next()
 		}
+		return true
 	}
+	return token == tokenLF
 }
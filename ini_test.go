@@ -2,10 +2,59 @@ package ini
 
 import (
 	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
+const gitConfig = `
+[user]
+  name  = Marc Weistroff
+  email = marc@example.org
+  foo-bar=blart
+  #email = marc@example.net
+[core]
+  excludesfile="~/.gitignore"
+[alias]
+  sdi  = diff --staged
+  sdiff = diff --staged
+  st   = status
+  cat  = cat-file -p
+  lg   = log --graph --pretty=tformat:'%Cred%h%Creset -%C(yellow)%d%Creset%s %Cgreen(%an %cr)%Creset' --abbrev-commit --date=relative
+  lga  = "!sh -c 'git log --author=\"$1\" -p $2' -"
+  lint = "!sh -c 'git status | awk \"/modified/ {print \\$3} /new file/ {print \\$4}\" | xargs -L 1 php -l'"
+  uncommit= reset --soft HEAD^
+[color]
+  branch = auto
+  diff = auto
+  interactive = auto
+  status = auto
+[ghi]
+    token = 4d3cf26439283fake6fd7ef50c8c6e3c
+`
+
+const phpIni = `
+[PHP]
+
+;;;;;;;;;;;;;;;;;;;
+; About php.ini   ;
+;;;;;;;;;;;;;;;;;;;
+
+engine = On
+short_open_tag = Off
+unserialize_callback_func =
+error_log = /usr/local/var/log/php-error.log
+[CLI Server]
+cli_server.color = On
+`
+
 func TestIniSetGet(t *testing.T) {
 	ini := NewIni()
 	if ini.Get("", "foo") != "" {
@@ -109,32 +158,7 @@ func TestIniLoadSections(t *testing.T) {
 }
 
 func TestIniLoadGitConfig(t *testing.T) {
-	config := bytes.NewBufferString(
-		`
-[user]
-  name  = Marc Weistroff
-  email = marc@example.org
-  foo-bar=blart
-  #email = marc@example.net
-[core]
-  excludesfile="~/.gitignore"
-[alias]
-  sdi  = diff --staged
-  sdiff = diff --staged
-  st   = status
-  cat  = cat-file -p
-  lg   = log --graph --pretty=tformat:'%Cred%h%Creset -%C(yellow)%d%Creset%s %Cgreen(%an %cr)%Creset' --abbrev-commit --date=relative
-  lga  = "!sh -c 'git log --author=\"$1\" -p $2' -"
-  lint = "!sh -c 'git status | awk \"/modified/ {print \\$3} /new file/ {print \\$4}\" | xargs -L 1 php -l'"
-  uncommit= reset --soft HEAD^
-[color]
-  branch = auto
-  diff = auto
-  interactive = auto
-  status = auto
-[ghi]
-    token = 4d3cf26439283fake6fd7ef50c8c6e3c
-`)
+	config := bytes.NewBufferString(gitConfig)
 
 	ini := NewIni()
 	_, err := ini.ReadFrom(config)
@@ -177,21 +201,7 @@ func TestIniLoadGitConfig(t *testing.T) {
 }
 
 func TestLoadPHPIni(t *testing.T) {
-	config := bytes.NewBufferString(
-		`
-[PHP]
-
-;;;;;;;;;;;;;;;;;;;
-; About php.ini   ;
-;;;;;;;;;;;;;;;;;;;
-
-engine = On
-short_open_tag = Off
-unserialize_callback_func =
-error_log = /usr/local/var/log/php-error.log
-[CLI Server]
-cli_server.color = On
-`)
+	config := bytes.NewBufferString(phpIni)
 	ini := NewIni()
 	_, err := ini.ReadFrom(config)
 	if err != nil {
@@ -275,3 +285,2120 @@ error_log = ${INITEST_USR_LOCAL}${INITEST_LOGDIR}/php-error.log
 		t.Errorf(ini.Get("PHP", "error_log"))
 	}
 }
+
+func TestRenameSection(t *testing.T) {
+	ini := NewIni()
+	ini.Set("foo", "bar", "foobar")
+	ini.Set("baz", "bar", "bazbar")
+
+	if err := ini.RenameSection("foo", "qux"); err != nil {
+		t.Error(err)
+	}
+	if ini.HasSection("foo") {
+		t.Error("old section should not exist anymore")
+	}
+	if v := ini.Get("qux", "bar"); v != "foobar" {
+		t.Errorf("Expected \"foobar\", got %#v", v)
+	}
+
+	if err := ini.RenameSection("foo", "quux"); err == nil {
+		t.Error("renaming a missing section should return an error")
+	}
+
+	if err := ini.RenameSection("qux", "baz"); err == nil {
+		t.Error("renaming onto an existing section should return an error")
+	}
+	if v := ini.Get("baz", "bar"); v != "bazbar" {
+		t.Errorf("Expected \"bazbar\", got %#v", v)
+	}
+}
+
+func TestWriteToSorted(t *testing.T) {
+	ini := NewIni()
+	ini.Set("zeta", "b", "2")
+	ini.Set("zeta", "a", "1")
+	ini.Set("alpha", "y", "4")
+	ini.Set("alpha", "x", "3")
+	ini.Set("", "g", "0")
+	ini.SetSortKeys(true)
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	expected := "g=0\n[alpha]\nx=3\ny=4\n[zeta]\na=1\nb=2\n"
+	if v := buffer.String(); v != expected {
+		t.Errorf("Expected %#v, got %#v", expected, v)
+	}
+}
+
+func TestWriteToQuotesOnlyWhenNeeded(t *testing.T) {
+	ini := NewIni()
+	ini.Set("PHP", "engine", "On")
+	ini.Set("PHP", "error_log", " spaced out ")
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	output := buffer.String()
+	if !strings.Contains(output, "engine=On\n") {
+		t.Errorf("Expected bare value, got %#v", output)
+	}
+	if !strings.Contains(output, "error_log=\" spaced out \"\n") {
+		t.Errorf("Expected quoted value, got %#v", output)
+	}
+
+	ini2 := NewIni()
+	if _, err := ini2.ReadFrom(buffer); err != nil {
+		t.Error(err)
+	}
+	if v := ini2.Get("PHP", "error_log"); v != " spaced out " {
+		t.Errorf("Expected \" spaced out \", got %#v", v)
+	}
+}
+
+func TestWriteToPreservesBlankLines(t *testing.T) {
+	input := "foo=bar\n\n[PHP]\nengine=On\n\n\nshort_open_tag=Off\ngreeting=\" hi\"\n\n[CLI Server]\ncli_server.color=On\n"
+	ini := NewIni()
+	if _, err := ini.ReadFrom(bytes.NewBufferString(input)); err != nil {
+		t.Error(err)
+	}
+	ini.SetPreserveFormatting(true)
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	if v := buffer.String(); v != input {
+		t.Errorf("Expected %#v, got %#v", input, v)
+	}
+
+	ini.SetPreserveFormatting(false)
+	buffer.Reset()
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	if v := buffer.String(); strings.Contains(v, "\n\n") {
+		t.Errorf("Expected no blank lines, got %#v", v)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ini, err := Load([]byte(gitConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("user", "name"); v != "Marc Weistroff" {
+		t.Errorf("Got %#v", v)
+	}
+	if v := ini.Get("alias", "st"); v != "status" {
+		t.Errorf("Got %#v", v)
+	}
+}
+
+func TestLoadString(t *testing.T) {
+	ini, err := LoadString("foo=bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("", "foo"); v != "bar" {
+		t.Errorf("Expected \"bar\", got %#v", v)
+	}
+}
+
+func TestIniLoadKeyWhitespace(t *testing.T) {
+	config := bytes.NewBufferString("  sdi  = diff --staged\na b = c\n\tindented = yes\n")
+	ini := NewIni()
+	if _, err := ini.ReadFrom(config); err != nil {
+		t.Error(err)
+	}
+	if v := ini.Get("", "sdi"); v != "diff --staged" {
+		t.Errorf("Expected \"diff --staged\", got %#v", v)
+	}
+	if v := ini.Get("", "a b"); v != "c" {
+		t.Errorf("Expected internal spaces to be preserved, got %#v", v)
+	}
+	if v := ini.Get("", "indented"); v != "yes" {
+		t.Errorf("Expected \"yes\", got %#v", v)
+	}
+}
+
+func TestMergeReader(t *testing.T) {
+	ini, err := LoadString("[db]\nhost=localhost\nport=5432\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ini.MergeReader(strings.NewReader("[db]\nhost=db.example.org\n[cache]\nsize=10\n")); err != nil {
+		t.Error(err)
+	}
+	if v := ini.Get("db", "host"); v != "db.example.org" {
+		t.Errorf("Expected overridden value, got %#v", v)
+	}
+	if v := ini.Get("db", "port"); v != "5432" {
+		t.Errorf("Expected base value, got %#v", v)
+	}
+	if v := ini.Get("cache", "size"); v != "10" {
+		t.Errorf("Expected merged value, got %#v", v)
+	}
+}
+
+func TestIniGetOK(t *testing.T) {
+	ini := NewIni()
+	ini.Set("PHP", "unserialize_callback_func", "")
+
+	if v, ok := ini.GetOK("PHP", "unserialize_callback_func"); !ok || v != "" {
+		t.Errorf("Expected present empty value, got %#v, %v", v, ok)
+	}
+	if v, ok := ini.GetOK("PHP", "engine"); ok || v != "" {
+		t.Errorf("Expected absent key, got %#v, %v", v, ok)
+	}
+	if _, ok := ini.GetOK("CLI Server", "engine"); ok {
+		t.Error("Expected absent section to report false")
+	}
+}
+
+func TestIniLoadUnescape(t *testing.T) {
+	input := `newline = a\nb
+tab = a\tb
+backslash = a\\b
+quote = say \"hi\"
+`
+	ini := NewIni()
+	ini.SetUnescape(true)
+	if _, err := ini.ReadFrom(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"newline":   "a\nb",
+		"tab":       "a\tb",
+		"backslash": `a\b`,
+		"quote":     `say "hi"`,
+	}
+	for k, v := range expected {
+		if got := ini.Get("", k); got != v {
+			t.Errorf("%s: expected %#v, got %#v", k, v, got)
+		}
+	}
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	ini2 := NewIni()
+	ini2.SetUnescape(true)
+	if _, err := ini2.ReadFrom(buffer); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range expected {
+		if got := ini2.Get("", k); got != v {
+			t.Errorf("%s: expected %#v after round-trip, got %#v", k, v, got)
+		}
+	}
+}
+
+func TestSetUnescapeRoundTripQuoted(t *testing.T) {
+	values := map[string]string{
+		"leading":  ` C:\new`,
+		"trailing": "a\\b\t ",
+		"comment":  `x ; y\z`,
+		"delim":    `a=b\"c"`,
+		"cr":       "a\rb",
+		"tab":      "a\t",
+		"newline":  "a\n",
+	}
+	for _, unescapeQuoted := range []bool{false, true} {
+		ini := NewIni()
+		ini.SetUnescape(true)
+		ini.SetUnescapeQuoted(unescapeQuoted)
+		ini.SetAll("test", values)
+
+		buffer := new(bytes.Buffer)
+		for i := 0; i < 2; i++ {
+			buffer.Reset()
+			if _, err := ini.WriteTo(buffer); err != nil {
+				t.Fatal(err)
+			}
+			for _, lineParser := range []bool{false, true} {
+				read := NewIni()
+				read.SetUnescape(true)
+				read.SetUnescapeQuoted(unescapeQuoted)
+				read.SetLineParser(lineParser)
+				if _, err := read.ReadFrom(strings.NewReader(buffer.String())); err != nil {
+					t.Fatal(err)
+				}
+				for k, v := range values {
+					if got := read.Get("test", k); got != v {
+						t.Errorf("%s: expected %#v after %d round-trips, got %#v", k, v, i+1, got)
+					}
+				}
+				ini = read
+			}
+		}
+	}
+}
+
+func TestIniLoadKeepsEscapesByDefault(t *testing.T) {
+	ini, err := LoadString(`path = C:\\temp\new`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("", "path"); v != `C:\\temp\new` {
+		t.Errorf("Got %#v", v)
+	}
+}
+
+func TestWriteToGlobalSection(t *testing.T) {
+	ini, err := LoadString("x=1\n[PHP]\nengine=On\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, last := range []bool{false, true} {
+		ini.SetGlobalSection("DEFAULT", last)
+		buffer := new(bytes.Buffer)
+		if _, err := ini.WriteTo(buffer); err != nil {
+			t.Error(err)
+		}
+		output := buffer.String()
+		if last && !strings.HasSuffix(output, "[DEFAULT]\nx=1\n") {
+			t.Errorf("Expected global section last, got %#v", output)
+		}
+		if !last && !strings.HasPrefix(output, "[DEFAULT]\nx=1\n") {
+			t.Errorf("Expected global section first, got %#v", output)
+		}
+
+		ini2 := NewIni()
+		ini2.SetGlobalSectionAlias("DEFAULT")
+		if _, err := ini2.ReadFrom(buffer); err != nil {
+			t.Error(err)
+		}
+		if v := ini2.Get("", "x"); v != "1" {
+			t.Errorf("Expected \"1\" in the global section, got %#v", v)
+		}
+		if ini2.HasSection("DEFAULT") {
+			t.Error("Expected no DEFAULT section")
+		}
+		if v := ini2.Get("PHP", "engine"); v != "On" {
+			t.Errorf("Expected \"On\", got %#v", v)
+		}
+	}
+}
+
+func TestIniLoadCommentPrefixes(t *testing.T) {
+	ini := NewIni()
+	ini.SetCommentPrefixes(";")
+	if _, err := ini.ReadFrom(strings.NewReader("; a comment\n#value=literal\ncolor=#ff0000\n")); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := ini.GetOK("", "#value"); !ok || v != "literal" {
+		t.Errorf("Expected \"#value\" to be read as a key, got %#v, %v", v, ok)
+	}
+	if v := ini.Get("", "color"); v != "#ff0000" {
+		t.Errorf("Expected \"#ff0000\", got %#v", v)
+	}
+}
+
+func TestLen(t *testing.T) {
+	ini, err := LoadString(gitConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Len(); v != 17 {
+		t.Errorf("Expected 17 keys, got %d", v)
+	}
+	if v := ini.SectionLen("alias"); v != 8 {
+		t.Errorf("Expected 8 keys in alias, got %d", v)
+	}
+	if v := ini.SectionLen("user"); v != 3 {
+		t.Errorf("Expected 3 keys in user, got %d", v)
+	}
+	if v := ini.SectionLen("missing"); v != 0 {
+		t.Errorf("Expected 0 keys in a missing section, got %d", v)
+	}
+}
+
+func TestIniLoadBareKeys(t *testing.T) {
+	config := "[log]\nverbose\nlevel = debug\nquiet"
+	ini := NewIni()
+	if _, err := ini.ReadFrom(strings.NewReader(config)); err == nil {
+		t.Error("bare keys should be rejected by default")
+	}
+
+	ini = NewIni()
+	ini.SetAllowBareKeys(true)
+	if _, err := ini.ReadFrom(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	if !ini.Has("log", "verbose") {
+		t.Error("Expected \"verbose\" to be present")
+	}
+	if v := ini.Get("log", "verbose"); v != "" {
+		t.Errorf("Expected empty value, got %#v", v)
+	}
+	if v := ini.Get("log", "level"); v != "debug" {
+		t.Errorf("Expected \"debug\", got %#v", v)
+	}
+	if !ini.Has("log", "quiet") {
+		t.Error("Expected \"quiet\" ended by EOF to be present")
+	}
+}
+
+func TestEachDoesNotBlockWriters(t *testing.T) {
+	ini, err := LoadString(phpIni)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var visited []string
+	ini.Each(func(section, key, value string) {
+		done := make(chan struct{})
+		go func() {
+			ini.Set("CLI Server", "visited", "yes")
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Set blocked while Each was running")
+		}
+		visited = append(visited, section+"."+key)
+	})
+
+	if len(visited) != 5 {
+		t.Errorf("Expected 5 entries, got %#v", visited)
+	}
+	if visited[0] != "PHP.engine" {
+		t.Errorf("Expected \"PHP.engine\" first, got %#v", visited[0])
+	}
+	if v := ini.Get("CLI Server", "visited"); v != "yes" {
+		t.Errorf("Expected \"yes\", got %#v", v)
+	}
+}
+
+func TestIniLoadLineEndings(t *testing.T) {
+	config := "foo=bar\n; comment\n\n[PHP]\nengine = On\nerror_log = \"/var/log/php.log\"\n[CLI Server]\ncli_server.color = On\n"
+	expected := NewIni()
+	if _, err := expected.ReadFrom(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	expectedJSON, _ := expected.MarshalJSON()
+
+	for _, ending := range []string{"\r\n", "\r"} {
+		ini := NewIni()
+		if _, err := ini.ReadFrom(strings.NewReader(strings.Replace(config, "\n", ending, -1))); err != nil {
+			t.Fatalf("%#v: %s", ending, err)
+		}
+		if v, _ := ini.MarshalJSON(); string(v) != string(expectedJSON) {
+			t.Errorf("%#v: expected %s, got %s", ending, expectedJSON, v)
+		}
+	}
+}
+
+func TestIniLoadIncludes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.ini":   "name = main\n@include other.ini\n[server]\nport = 80\n",
+		"other.ini":  "[db]\nhost = localhost\n",
+		"cycle.ini":  "@include cycle2.ini\n",
+		"cycle2.ini": "@include cycle.ini\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ini := NewIni()
+	ini.SetAllowIncludes(dir)
+	if _, err := ini.ReadFrom(strings.NewReader(files["main.ini"])); err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("db", "host"); v != "localhost" {
+		t.Errorf("Expected included value, got %#v", v)
+	}
+	if v := ini.Get("server", "port"); v != "80" {
+		t.Errorf("Expected \"80\", got %#v", v)
+	}
+
+	ini = NewIni()
+	ini.SetAllowIncludes(dir)
+	if _, err := ini.ReadFrom(strings.NewReader(files["cycle.ini"])); err == nil {
+		t.Error("include cycle should return an error")
+	}
+}
+
+func TestAppendValue(t *testing.T) {
+	ini := NewIni()
+	ini.AppendValue("remote", "fetch", "a")
+	ini.AppendValue("remote", "fetch", "b")
+	ini.AppendValue("remote", "fetch", "c")
+
+	if v := ini.Get("remote", "fetch"); v != "c" {
+		t.Errorf("Expected last value \"c\", got %#v", v)
+	}
+	if v := ini.GetAll("remote", "fetch"); strings.Join(v, ",") != "a,b,c" {
+		t.Errorf("Expected [a b c], got %#v", v)
+	}
+	if v := ini.GetAll("remote", "missing"); v != nil {
+		t.Errorf("Expected nil, got %#v", v)
+	}
+
+	ini.Set("remote", "fetch", "d")
+	if v := ini.GetAll("remote", "fetch"); strings.Join(v, ",") != "d" {
+		t.Errorf("Expected Set to replace every value, got %#v", v)
+	}
+}
+
+func TestIniLoadTrimValues(t *testing.T) {
+	config := "key =   spaced   \n"
+	ini, err := LoadString(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("", "key"); v != "spaced" {
+		t.Errorf("Expected trimmed value, got %#v", v)
+	}
+
+	ini = NewIni()
+	ini.SetTrimValues(false)
+	if _, err := ini.ReadFrom(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("", "key"); v != "   spaced   " {
+		t.Errorf("Expected untrimmed value, got %#v", v)
+	}
+}
+
+func TestWriteToReturnsBytesWritten(t *testing.T) {
+	ini, err := LoadString(phpIni)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ini.AppendValue("CLI Server", "extension", "a.so")
+	ini.AppendValue("CLI Server", "extension", "b.so")
+	ini.Set("", "foobar", "absolute foobaritude")
+
+	for _, preserve := range []bool{false, true} {
+		ini.SetPreserveFormatting(preserve)
+		buffer := new(bytes.Buffer)
+		n, err := ini.WriteTo(buffer)
+		if err != nil {
+			t.Error(err)
+		}
+		if n != int64(buffer.Len()) {
+			t.Errorf("Expected %d bytes, WriteTo returned %d", buffer.Len(), n)
+		}
+	}
+}
+
+func TestWriteToEmptySections(t *testing.T) {
+	ini, err := LoadString("[placeholder]\n[PHP]\nengine=On\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ini.AddSection("extensions")
+	if !ini.HasSection("placeholder") || !ini.HasSection("extensions") {
+		t.Error("Expected empty sections to exist")
+	}
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	if v := buffer.String(); v != "[PHP]\nengine=On\n" {
+		t.Errorf("Expected empty sections to be skipped, got %#v", v)
+	}
+
+	ini.SetWriteEmptySections(true)
+	buffer.Reset()
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	if v := buffer.String(); v != "[placeholder]\n[PHP]\nengine=On\n[extensions]\n" {
+		t.Errorf("Expected empty section headers, got %#v", v)
+	}
+}
+
+func TestParse(t *testing.T) {
+	var entries []string
+	err := Parse(strings.NewReader(gitConfig), func(section, key, value string) error {
+		entries = append(entries, section+"."+key+"="+value)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 17 {
+		t.Errorf("Expected 17 entries, got %d", len(entries))
+	}
+	if entries[0] != "user.name=Marc Weistroff" {
+		t.Errorf("Got %#v", entries[0])
+	}
+	if entries[16] != "ghi.token=4d3cf26439283fake6fd7ef50c8c6e3c" {
+		t.Errorf("Got %#v", entries[16])
+	}
+
+	abort := errors.New("abort")
+	count := 0
+	err = Parse(strings.NewReader(gitConfig), func(section, key, value string) error {
+		count++
+		if section == "core" {
+			return abort
+		}
+		return nil
+	})
+	if err != abort {
+		t.Errorf("Expected the callback error, got %v", err)
+	}
+	if count != 4 {
+		t.Errorf("Expected parsing to stop at core.excludesfile, got %d calls", count)
+	}
+}
+
+func TestIniLoadSectionWithComment(t *testing.T) {
+	ini, err := LoadString("[database] ; production\nhost = db.example.org\n[cache]# local\nsize = 10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("database", "host"); v != "db.example.org" {
+		t.Errorf("Expected \"db.example.org\", got %#v", v)
+	}
+	if v := ini.Get("cache", "size"); v != "10" {
+		t.Errorf("Expected \"10\", got %#v", v)
+	}
+	if v := ini.SectionLen("database"); v != 1 {
+		t.Errorf("Expected 1 key in database, got %d", v)
+	}
+}
+
+func TestIniLoadSectionWithTrailingText(t *testing.T) {
+	for _, lineParser := range []bool{false, true} {
+		ini := NewIni()
+		ini.SetLineParser(lineParser)
+		if _, err := ini.ReadFrom(strings.NewReader("[a]k=v\n")); err == nil || !strings.Contains(err.Error(), "after ']'") {
+			t.Errorf("line parser %v: expected an error for text after the section header, got %v", lineParser, err)
+		}
+		if _, err := ini.ReadFrom(strings.NewReader("[a] \t\nk=v\n")); err != nil {
+			t.Errorf("line parser %v: expected blanks after the section header to be ignored, got %v", lineParser, err)
+		}
+	}
+}
+
+func TestIniLoadQuotedNewlines(t *testing.T) {
+	ini, err := LoadString(`motd = "Welcome!\nHave a nice day."` + "\n" + `path = "C:\\new"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("", "motd"); v != "Welcome!\nHave a nice day." {
+		t.Errorf("Expected two lines, got %#v", v)
+	}
+	if v := ini.Get("", "path"); v != `C:\\new` {
+		t.Errorf("Expected escaped backslash to be kept, got %#v", v)
+	}
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(buffer.String(), `motd="Welcome!\nHave a nice day."`) {
+		t.Errorf("Expected newline to be encoded, got %#v", buffer.String())
+	}
+	ini2 := NewIni()
+	if _, err := ini2.ReadFrom(buffer); err != nil {
+		t.Fatal(err)
+	}
+	if v := ini2.Get("", "motd"); v != "Welcome!\nHave a nice day." {
+		t.Errorf("Expected lossless round-trip, got %#v", v)
+	}
+	if v := ini2.Get("", "path"); v != `C:\\new` {
+		t.Errorf("Expected lossless round-trip, got %#v", v)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	base, err := LoadString(phpIni)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified, err := LoadString(phpIni)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified.Set("PHP", "engine", "Off")
+	modified.Set("PHP", "memory_limit", "128M")
+	modified.RenameSection("CLI Server", "CLI")
+
+	added, removed, changed := base.Diff(modified)
+	if strings.Join(added, ",") != "PHP.memory_limit,CLI.cli_server.color" {
+		t.Errorf("Got added %#v", added)
+	}
+	if strings.Join(removed, ",") != "CLI Server.cli_server.color" {
+		t.Errorf("Got removed %#v", removed)
+	}
+	if strings.Join(changed, ",") != "PHP.engine" {
+		t.Errorf("Got changed %#v", changed)
+	}
+
+	if added, removed, changed := base.Diff(base); added != nil || removed != nil || changed != nil {
+		t.Errorf("Expected no difference, got %#v %#v %#v", added, removed, changed)
+	}
+}
+
+func TestGetNested(t *testing.T) {
+	ini, err := LoadString("[a]\nkey = top\n[a.b]\nkey = nested\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("a.b", "key"); v != "nested" {
+		t.Errorf("Expected dotted section to be stored as is, got %#v", v)
+	}
+	if v := ini.GetNested("a", "b", "key"); v != "nested" {
+		t.Errorf("Expected \"nested\", got %#v", v)
+	}
+	if v := ini.GetNested("a", "key"); v != "top" {
+		t.Errorf("Expected \"top\", got %#v", v)
+	}
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(buffer.String(), "[a.b]\n") {
+		t.Errorf("Expected dotted header to be written back, got %#v", buffer.String())
+	}
+}
+
+func TestIniLoadGlobalKeys(t *testing.T) {
+	config := "foo=bar\n[PHP]\nengine=On\n"
+	ini := NewIni()
+	if _, err := ini.ReadFrom(strings.NewReader(config)); err != nil {
+		t.Error(err)
+	}
+
+	ini = NewIni()
+	ini.SetAllowGlobalKeys(false)
+	_, err := ini.ReadFrom(strings.NewReader(config))
+	if err == nil {
+		t.Fatal("a key outside any section should return an error")
+	}
+	if !strings.Contains(err.Error(), "1:1") {
+		t.Errorf("Expected the error to locate the key, got %v", err)
+	}
+
+	ini = NewIni()
+	ini.SetAllowGlobalKeys(false)
+	if _, err := ini.ReadFrom(strings.NewReader(phpIni)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config/php.ini": &fstest.MapFile{Data: []byte(phpIni)},
+	}
+	ini, err := LoadFS(fsys, "config/php.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("PHP", "engine"); v != "On" {
+		t.Errorf("Expected \"On\", got %#v", v)
+	}
+	if _, err := LoadFS(fsys, "missing.ini"); err == nil {
+		t.Error("a missing file should return an error")
+	}
+}
+
+func TestTypedSetters(t *testing.T) {
+	ini := NewIni()
+	ini.SetInt("server", "port", -8080)
+	ini.SetBool("server", "debug", false)
+	ini.SetFloat64("server", "ratio", 0.1)
+
+	if v := ini.Get("server", "debug"); v != "false" {
+		t.Errorf("Expected \"false\", got %#v", v)
+	}
+	if v, err := ini.GetInt("server", "port"); err != nil || v != -8080 {
+		t.Errorf("Expected -8080, got %v, %v", v, err)
+	}
+	if v, err := ini.GetBool("server", "debug"); err != nil || v {
+		t.Errorf("Expected false, got %v, %v", v, err)
+	}
+	if v, err := ini.GetFloat64("server", "ratio"); err != nil || v != 0.1 {
+		t.Errorf("Expected 0.1, got %v, %v", v, err)
+	}
+}
+
+func TestWriteToPreservesQuoteStyle(t *testing.T) {
+	ini, err := LoadString(gitConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	output := buffer.String()
+	if !strings.Contains(output, "excludesfile=\"~/.gitignore\"\n") {
+		t.Errorf("Expected quoted value to stay quoted, got %#v", output)
+	}
+	if !strings.Contains(output, "st=status\n") {
+		t.Errorf("Expected bare value to stay bare, got %#v", output)
+	}
+
+	ini2 := NewIni()
+	if _, err := ini2.ReadFrom(buffer); err != nil {
+		t.Fatal(err)
+	}
+	if v := ini2.Get("core", "excludesfile"); v != "~/.gitignore" {
+		t.Errorf("Got %#v", v)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	ini := NewIni()
+	ini.Set("db", "port", "5432")
+	ini.Set("db", "host", "localhost")
+	ini.Set("db", "name", "app")
+
+	if v := ini.Keys("db"); strings.Join(v, ",") != "port,host,name" {
+		t.Errorf("Expected insertion order, got %#v", v)
+	}
+	if v := ini.SortedKeys("db"); strings.Join(v, ",") != "host,name,port" {
+		t.Errorf("Expected alphabetical order, got %#v", v)
+	}
+	if v := ini.Keys("missing"); len(v) != 0 {
+		t.Errorf("Expected no keys, got %#v", v)
+	}
+}
+
+func TestIniLoadArrayKeys(t *testing.T) {
+	config := "[memcache]\nhosts[] = a.example.org\nhosts[] = b.example.org\nport = 11211\n"
+	ini := NewIni()
+	ini.SetArrayKeys(true)
+	if _, err := ini.ReadFrom(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.GetAll("memcache", "hosts"); strings.Join(v, ",") != "a.example.org,b.example.org" {
+		t.Errorf("Expected two hosts, got %#v", v)
+	}
+	if ini.Has("memcache", "hosts[]") {
+		t.Error("Expected the [] suffix to be stripped")
+	}
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	expected := "[memcache]\nhosts[]=a.example.org\nhosts[]=b.example.org\nport=11211\n"
+	if v := buffer.String(); v != expected {
+		t.Errorf("Expected %#v, got %#v", expected, v)
+	}
+
+	ini, err := LoadString(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("memcache", "hosts[]"); v != "b.example.org" {
+		t.Errorf("Expected array syntax to be ignored by default, got %#v", v)
+	}
+}
+
+func TestWriteToIndented(t *testing.T) {
+	ini, err := LoadString("editor = vim\n[user]\nname = Marc Weistroff\nemail = marc@example.org\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ini.SetIndent("  ")
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	expected := "editor=vim\n[user]\n  name=Marc Weistroff\n  email=marc@example.org\n"
+	if v := buffer.String(); v != expected {
+		t.Errorf("Expected %#v, got %#v", expected, v)
+	}
+
+	ini2 := NewIni()
+	if _, err := ini2.ReadFrom(buffer); err != nil {
+		t.Fatal(err)
+	}
+	if v := ini2.Get("user", "name"); v != "Marc Weistroff" {
+		t.Errorf("Got %#v", v)
+	}
+}
+
+func TestIniLoadValueWithEquals(t *testing.T) {
+	ini, err := LoadString("url = https://x/?a=b\nquery=a=b&c=d\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("", "url"); v != "https://x/?a=b" {
+		t.Errorf("Expected \"https://x/?a=b\", got %#v", v)
+	}
+	if v := ini.Get("", "query"); v != "a=b&c=d" {
+		t.Errorf("Expected \"a=b&c=d\", got %#v", v)
+	}
+	if v := ini.Keys(""); strings.Join(v, ",") != "url,query" {
+		t.Errorf("Expected only the first '=' to delimit keys, got %#v", v)
+	}
+}
+
+func TestGetFold(t *testing.T) {
+	ini, err := LoadString(gitConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.GetFold("User", "Name"); v != "Marc Weistroff" {
+		t.Errorf("Expected \"Marc Weistroff\", got %#v", v)
+	}
+	if v := ini.GetFold("user", "EMAIL"); v != "marc@example.org" {
+		t.Errorf("Expected \"marc@example.org\", got %#v", v)
+	}
+	if v := ini.Get("User", "Name"); v != "" {
+		t.Errorf("Expected Get to stay case-sensitive, got %#v", v)
+	}
+	if v := ini.GetFold("user", "missing"); v != "" {
+		t.Errorf("Expected empty string, got %#v", v)
+	}
+}
+
+func TestIniLoadSectionWhitespace(t *testing.T) {
+	ini, err := LoadString("[ core ]\neditor = vim\n[CLI Server]\ncli_server.color = On\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("core", "editor"); v != "vim" {
+		t.Errorf("Expected \"vim\", got %#v", v)
+	}
+	if ini.HasSection(" core ") {
+		t.Error("Expected section name to be trimmed")
+	}
+	if v := ini.Get("CLI Server", "cli_server.color"); v != "On" {
+		t.Errorf("Expected internal space to be preserved, got %#v", v)
+	}
+}
+
+func TestIniLoadLowercaseKeys(t *testing.T) {
+	ini := NewIni()
+	ini.SetLowercaseKeys(true)
+	if _, err := ini.ReadFrom(strings.NewReader("[User]\nName = x\n")); err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("User", "name"); v != "x" {
+		t.Errorf("Expected \"x\", got %#v", v)
+	}
+	if !ini.Has("User", "NAME") {
+		t.Error("Expected keys to be matched case-insensitively")
+	}
+	if ini.HasSection("user") {
+		t.Error("Expected section name to be preserved")
+	}
+	if v := ini.Keys("User"); strings.Join(v, ",") != "name" {
+		t.Errorf("Expected lowercased key, got %#v", v)
+	}
+}
+
+func TestLowercaseKeysAfterLoad(t *testing.T) {
+	ini, err := LoadString("[User]\nName = x\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ini.SetLowercaseKeys(true)
+
+	var buffer bytes.Buffer
+	if _, err := ini.WriteTo(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if v := buffer.String(); v != "[User]\nName=x\n" {
+		t.Errorf("Expected the keys stored before to be written, got %#v", v)
+	}
+	if v := ini.Keys("User"); strings.Join(v, ",") != "Name" {
+		t.Errorf("Expected the stored key to be kept, got %#v", v)
+	}
+}
+
+func TestIniLoadStrayLine(t *testing.T) {
+	_, err := LoadString("[PHP]\nengine = On\njusttext\nshort_open_tag = Off\n")
+	if err == nil {
+		t.Fatal("a line without '=' should return an error")
+	}
+	if !strings.Contains(err.Error(), "expected '='") || !strings.Contains(err.Error(), "3:1") {
+		t.Errorf("Expected the error to locate the stray line, got %v", err)
+	}
+}
+
+func TestSetMulti(t *testing.T) {
+	ini := NewIni()
+	ini.Set("remote", "url", "git@example.org:repo.git")
+	ini.SetMulti("remote", "fetch", []string{"a", "b", "c"})
+	if v := ini.GetAll("remote", "fetch"); strings.Join(v, ",") != "a,b,c" {
+		t.Errorf("Expected [a b c], got %#v", v)
+	}
+
+	ini.SetMulti("remote", "fetch", []string{"d", "e"})
+	if v := ini.GetAll("remote", "fetch"); strings.Join(v, ",") != "d,e" {
+		t.Errorf("Expected [d e], got %#v", v)
+	}
+	if v := ini.Get("remote", "fetch"); v != "e" {
+		t.Errorf("Expected last value \"e\", got %#v", v)
+	}
+
+	ini.SetMulti("remote", "fetch", nil)
+	if ini.Has("remote", "fetch") {
+		t.Error("Expected an empty slice to remove the key")
+	}
+	if v := ini.Keys("remote"); strings.Join(v, ",") != "url" {
+		t.Errorf("Expected only url to remain, got %#v", v)
+	}
+}
+
+func TestLoadFileGzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "php.ini.gz")
+	buffer := new(bytes.Buffer)
+	w := gzip.NewWriter(buffer)
+	w.Write([]byte(phpIni))
+	w.Close()
+	if err := os.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ini, err := LoadFileGzip(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("PHP", "error_log"); v != "/usr/local/var/log/php-error.log" {
+		t.Errorf("Got %#v", v)
+	}
+
+	plain := filepath.Join(t.TempDir(), "php.ini")
+	if err := os.WriteFile(plain, []byte(phpIni), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFileGzip(plain); err == nil {
+		t.Error("an uncompressed file should return an error")
+	}
+}
+
+func TestRenameKey(t *testing.T) {
+	ini, err := LoadString(phpIni)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ini.RenameKey("PHP", "short_open_tag", "short_tags"); err != nil {
+		t.Error(err)
+	}
+	if ini.Has("PHP", "short_open_tag") {
+		t.Error("old key should not exist anymore")
+	}
+	if v := ini.Get("PHP", "short_tags"); v != "Off" {
+		t.Errorf("Expected \"Off\", got %#v", v)
+	}
+	if v := ini.Keys("PHP"); strings.Join(v, ",") != "engine,short_tags,unserialize_callback_func,error_log" {
+		t.Errorf("Expected order to be preserved, got %#v", v)
+	}
+
+	if err := ini.RenameKey("PHP", "short_open_tag", "other"); err == nil {
+		t.Error("renaming a missing key should return an error")
+	}
+	if err := ini.RenameKey("PHP", "short_tags", "engine"); err == nil {
+		t.Error("renaming onto an existing key should return an error")
+	}
+	if v := ini.Get("PHP", "engine"); v != "On" {
+		t.Errorf("Expected \"On\", got %#v", v)
+	}
+}
+
+func TestGetFallback(t *testing.T) {
+	ini, err := LoadString("[defaults]\ntimeout = 30\nretries = 3\n[production]\nretries = 5\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.GetFallback("timeout", "production", "defaults"); v != "30" {
+		t.Errorf("Expected \"30\" from the second section, got %#v", v)
+	}
+	if v := ini.GetFallback("retries", "production", "defaults"); v != "5" {
+		t.Errorf("Expected \"5\" from the first section, got %#v", v)
+	}
+	if v := ini.GetFallback("missing", "production", "defaults"); v != "" {
+		t.Errorf("Expected empty string, got %#v", v)
+	}
+}
+
+func TestIniLoadTabs(t *testing.T) {
+	ini, err := LoadString("[table]\n\tcolumns\t=\tid\tname\temail\t\n\tname = x\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("table", "columns"); v != "id\tname\temail" {
+		t.Errorf("Expected tab-separated value, got %#v", v)
+	}
+	if v := ini.Get("table", "name"); v != "x" {
+		t.Errorf("Expected tab-indented key, got %#v", v)
+	}
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	ini2 := NewIni()
+	if _, err := ini2.ReadFrom(buffer); err != nil {
+		t.Fatal(err)
+	}
+	if v := ini2.Get("table", "columns"); v != "id\tname\temail" {
+		t.Errorf("Expected tabs to survive a round-trip, got %#v", v)
+	}
+}
+
+func TestEncodeTo(t *testing.T) {
+	ini, err := LoadString("[core]\nexcludesfile = \"~/.gitignore\"\neditor = vim\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts     EncodeOptions
+		expected string
+	}{
+		{EncodeOptions{}, "[core]\nexcludesfile=~/.gitignore\neditor=vim\n"},
+		{EncodeOptions{Quoting: QuoteOriginal, Delimiter: " = ", Indent: "\t"}, "[core]\n\texcludesfile = \"~/.gitignore\"\n\teditor = vim\n"},
+		{EncodeOptions{Quoting: QuoteAll, Sort: true}, "[core]\neditor=\"vim\"\nexcludesfile=\"~/.gitignore\"\n"},
+	}
+	for _, test := range tests {
+		buffer := new(bytes.Buffer)
+		n, err := ini.EncodeTo(buffer, test.opts)
+		if err != nil {
+			t.Error(err)
+		}
+		if n != int64(buffer.Len()) {
+			t.Errorf("Expected %d bytes, EncodeTo returned %d", buffer.Len(), n)
+		}
+		if v := buffer.String(); v != test.expected {
+			t.Errorf("%+v: expected %#v, got %#v", test.opts, test.expected, v)
+		}
+
+		ini2 := NewIni()
+		if _, err := ini2.ReadFrom(buffer); err != nil {
+			t.Fatal(err)
+		}
+		if v := ini2.Get("core", "excludesfile"); v != "~/.gitignore" {
+			t.Errorf("%+v: got %#v after re-parsing", test.opts, v)
+		}
+		if v := ini2.Get("core", "editor"); v != "vim" {
+			t.Errorf("%+v: got %#v after re-parsing", test.opts, v)
+		}
+	}
+}
+
+func TestKeysWithPrefix(t *testing.T) {
+	ini, err := LoadString("[app]\nlog.level = debug\nname = web\nlog.file = /var/log/app.log\nlogger = syslog\nlog.format = json\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.KeysWithPrefix("app", "log."); strings.Join(v, ",") != "log.file,log.format,log.level" {
+		t.Errorf("Got %#v", v)
+	}
+	if v := ini.KeysWithPrefix("app", "db."); len(v) != 0 {
+		t.Errorf("Expected no keys, got %#v", v)
+	}
+}
+
+func TestWriteToEmptyValue(t *testing.T) {
+	ini, err := LoadString(phpIni)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(buffer.String(), "\nunserialize_callback_func=\n") {
+		t.Errorf("Expected a bare empty value, got %#v", buffer.String())
+	}
+
+	ini2 := NewIni()
+	if _, err := ini2.ReadFrom(buffer); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := ini2.GetOK("PHP", "unserialize_callback_func"); !ok || v != "" {
+		t.Errorf("Expected a present empty value, got %#v, %v", v, ok)
+	}
+}
+
+func TestComment(t *testing.T) {
+	config := `
+[PHP]
+; Decides whether PHP may expose the fact that it is installed on the server.
+; http://php.net/expose-php
+expose_php = On
+
+; Detached from the key below.
+
+engine = On
+  # Indented comment
+short_open_tag = Off
+`
+	ini, err := LoadString(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Decides whether PHP may expose the fact that it is installed on the server.\nhttp://php.net/expose-php"
+	if v := ini.Comment("PHP", "expose_php"); v != expected {
+		t.Errorf("Expected %#v, got %#v", expected, v)
+	}
+	if v := ini.Comment("PHP", "engine"); v != "" {
+		t.Errorf("Expected no comment, got %#v", v)
+	}
+	if v := ini.Comment("PHP", "short_open_tag"); v != "Indented comment" {
+		t.Errorf("Expected \"Indented comment\", got %#v", v)
+	}
+	if v := ini.Comment("PHP", "missing"); v != "" {
+		t.Errorf("Expected no comment, got %#v", v)
+	}
+}
+
+func TestSetComment(t *testing.T) {
+	ini, err := LoadString("[PHP]\nengine = On\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ini.SetComment("PHP", "engine", "Enable the PHP scripting language engine.\nhttp://php.net/engine")
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	expected := "[PHP]\n; Enable the PHP scripting language engine.\n; http://php.net/engine\nengine=On\n"
+	if v := buffer.String(); v != expected {
+		t.Errorf("Expected %#v, got %#v", expected, v)
+	}
+
+	ini2 := NewIni()
+	if _, err := ini2.ReadFrom(buffer); err != nil {
+		t.Fatal(err)
+	}
+	if v := ini2.Comment("PHP", "engine"); v != ini.Comment("PHP", "engine") {
+		t.Errorf("Expected the comment to round-trip, got %#v", v)
+	}
+}
+
+func TestSectionAt(t *testing.T) {
+	ini, err := LoadString(gitConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := ini.SectionAt(0); !ok || v != "user" {
+		t.Errorf("Expected \"user\", got %#v, %v", v, ok)
+	}
+	if v, ok := ini.SectionAt(4); !ok || v != "ghi" {
+		t.Errorf("Expected \"ghi\", got %#v, %v", v, ok)
+	}
+	if _, ok := ini.SectionAt(5); ok {
+		t.Error("Expected false past the last section")
+	}
+	if _, ok := ini.SectionAt(-1); ok {
+		t.Error("Expected false for a negative index")
+	}
+}
+
+func TestSlashComments(t *testing.T) {
+	ini := NewIni()
+	ini.SetCommentPrefixes("//", ";")
+	_, err := ini.ReadFrom(strings.NewReader(`// leading comment
+[server]
+// the host
+host = example.com
+path=/var/www
+; classic comment
+/tmp = cache
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Len(); v != 3 {
+		t.Errorf("Expected 3 keys, got %d", v)
+	}
+	if v := ini.Get("server", "host"); v != "example.com" {
+		t.Errorf("Expected \"example.com\", got %#v", v)
+	}
+	if v := ini.Comment("server", "host"); v != "the host" {
+		t.Errorf("Expected \"the host\", got %#v", v)
+	}
+	if v := ini.Get("server", "/tmp"); v != "cache" {
+		t.Errorf("Expected \"cache\", got %#v", v)
+	}
+}
+
+func TestMergeFunc(t *testing.T) {
+	ini := NewIni()
+	ini.Set("path", "bin", "/usr/bin")
+	ini.Set("path", "lib", "/usr/lib")
+	other := NewIni()
+	other.Set("path", "bin", "/opt/bin")
+	other.Set("path", "man", "/usr/share/man")
+
+	ini.MergeFunc(other, func(section, key, a, b string) string {
+		return a + ":" + b
+	})
+	expected := map[string]string{"bin": "/usr/bin:/opt/bin", "lib": "/usr/lib", "man": "/usr/share/man"}
+	for key, value := range expected {
+		if v := ini.Get("path", key); v != value {
+			t.Errorf("Expected %#v for %s, got %#v", value, key, v)
+		}
+	}
+
+	ini.Merge(other)
+	if v := ini.Get("path", "bin"); v != "/opt/bin" {
+		t.Errorf("Expected \"/opt/bin\", got %#v", v)
+	}
+}
+
+func TestWriteToControlCharacters(t *testing.T) {
+	ini, err := LoadString(gitConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{
+		"tabbed":  "a\tb\nc",
+		"leading": "\tindented",
+		"nul":     "a\x00b",
+	}
+	ini.SetAll("test", values)
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Fatal(err)
+	}
+	for _, lineParser := range []bool{false, true} {
+		read := NewIni()
+		read.SetLineParser(lineParser)
+		if _, err := read.ReadFrom(strings.NewReader(buffer.String())); err != nil {
+			t.Fatalf("line parser %v: %v", lineParser, err)
+		}
+		for key, expected := range values {
+			if v := read.Get("test", key); v != expected {
+				t.Errorf("line parser %v: expected %#v for %s, got %#v", lineParser, expected, key, v)
+			}
+		}
+		if v, expected := read.Get("alias", "lint"), ini.Get("alias", "lint"); v != expected {
+			t.Errorf("line parser %v: expected %#v, got %#v", lineParser, expected, v)
+		}
+	}
+
+	// Quotes, backslashes and carriage returns are only escaped losslessly
+	// when quoted values are unescaped.
+	unescaped := NewIni()
+	unescaped.SetUnescapeQuoted(true)
+	escapes := map[string]string{
+		"quoted":    `a"b`,
+		"quote":     `"`,
+		"backslash": ` a\`,
+		"escapes":   `C:\new\"x\\`,
+		"cr":        "a\rb",
+	}
+	unescaped.SetAll("test", escapes)
+	buffer.Reset()
+	if _, err := unescaped.WriteTo(buffer); err != nil {
+		t.Fatal(err)
+	}
+	for _, lineParser := range []bool{false, true} {
+		read := NewIni()
+		read.SetLineParser(lineParser)
+		read.SetUnescapeQuoted(true)
+		if _, err := read.ReadFrom(strings.NewReader(buffer.String())); err != nil {
+			t.Fatalf("line parser %v: %v", lineParser, err)
+		}
+		for key, expected := range escapes {
+			if v := read.Get("test", key); v != expected {
+				t.Errorf("line parser %v: expected %#v for %s, got %#v", lineParser, expected, key, v)
+			}
+		}
+	}
+
+	// Without it, such values are altered but the output still parses.
+	ini.Set("test", "backslash", ` a\`)
+	buffer.Reset()
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadString(buffer.String()); err != nil {
+		t.Errorf("Expected the output to parse, got %v", err)
+	}
+}
+
+func TestSetDelimiterSpacing(t *testing.T) {
+	ini, err := LoadString("[user]\nname  = Marc Weistroff\nemail=marc@example.org\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	expected := "[user]\nname=Marc Weistroff\nemail=marc@example.org\n"
+	if v := buffer.String(); v != expected {
+		t.Errorf("Expected %#v, got %#v", expected, v)
+	}
+
+	ini.SetDelimiterSpacing(" = ")
+	buffer.Reset()
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Error(err)
+	}
+	expected = "[user]\nname = Marc Weistroff\nemail = marc@example.org\n"
+	if v := buffer.String(); v != expected {
+		t.Errorf("Expected %#v, got %#v", expected, v)
+	}
+
+	ini.SetDelimiterSpacing(": ")
+	if _, err := ini.WriteTo(new(bytes.Buffer)); err == nil {
+		t.Error("Expected an error for a delimiter without '='")
+	}
+	if _, err := ini.EncodeTo(new(bytes.Buffer), EncodeOptions{Delimiter: "=="}); err == nil {
+		t.Error("Expected an error for a delimiter not read back")
+	}
+}
+
+func TestMaxLength(t *testing.T) {
+	ini := NewIni()
+	ini.SetMaxValueLength(8)
+	if _, err := ini.ReadFrom(strings.NewReader("[a]\nshort=12345678\n")); err != nil {
+		t.Errorf("Expected no error at the limit, got %v", err)
+	}
+	if _, err := ini.ReadFrom(strings.NewReader("[a]\nlong=123456789\n")); err == nil || !strings.Contains(err.Error(), "longer than 8 bytes") {
+		t.Errorf("Expected a value length error, got %v", err)
+	}
+	if _, err := ini.ReadFrom(strings.NewReader("[a]\nlong=\"123456789\"\n")); err == nil {
+		t.Error("Expected a value length error for a quoted value")
+	}
+
+	ini = NewIni()
+	ini.SetMaxLineLength(10)
+	if _, err := ini.ReadFrom(strings.NewReader("[a]\nkey=123456\n")); err != nil {
+		t.Errorf("Expected no error at the limit, got %v", err)
+	}
+	if _, err := ini.ReadFrom(strings.NewReader("[a]\nkey=1234567\n")); err == nil || !strings.Contains(err.Error(), "longer than 10 characters") {
+		t.Errorf("Expected a line length error, got %v", err)
+	}
+	if _, err := ini.ReadFrom(strings.NewReader("[a]\nverylongkey=1\n")); err == nil {
+		t.Error("Expected a line length error for a long key")
+	}
+
+	for _, lineParser := range []bool{false, true} {
+		ini = NewIni()
+		ini.SetLineParser(lineParser)
+		ini.SetMaxLineLength(5)
+		for _, input := range []string{
+			"[" + strings.Repeat("a", 1000) + "]\n",
+			"[a] ; " + strings.Repeat("a", 1000) + "\n",
+			"; " + strings.Repeat("a", 1000) + "\n",
+			"[a]\nk=\"" + strings.Repeat("a", 1000) + "\"\n",
+			"[a]\nk=\"" + strings.Repeat("a", 1000),
+		} {
+			if _, err := ini.ReadFrom(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), "longer than 5 characters") {
+				t.Errorf("line parser %v: expected a line length error for %.12q, got %v", lineParser, input, err)
+			}
+		}
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	ini := NewIni()
+	ini.SetMaxEntries(17)
+	if _, err := ini.ReadFrom(strings.NewReader(gitConfig)); err != nil {
+		t.Errorf("Expected no error at the limit, got %v", err)
+	}
+
+	ini = NewIni()
+	ini.SetMaxEntries(16)
+	if _, err := ini.ReadFrom(strings.NewReader(gitConfig)); err == nil || !strings.Contains(err.Error(), "more than 16 entries") {
+		t.Errorf("Expected an entry limit error, got %v", err)
+	}
+	if v := ini.Len(); v != 16 {
+		t.Errorf("Expected 16 keys stored before the error, got %d", v)
+	}
+}
+
+func TestReadSection(t *testing.T) {
+	values, err := ReadSection(strings.NewReader(phpIni), "PHP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"engine":                    "On",
+		"short_open_tag":            "Off",
+		"unserialize_callback_func": "",
+		"error_log":                 "/usr/local/var/log/php-error.log",
+	}
+	if len(values) != len(expected) {
+		t.Errorf("Expected %d keys, got %#v", len(expected), values)
+	}
+	for key, value := range expected {
+		if v, ok := values[key]; !ok || v != value {
+			t.Errorf("Expected %#v for %s, got %#v", value, key, v)
+		}
+	}
+
+	if values, err := ReadSection(strings.NewReader(phpIni), "missing"); err != nil || len(values) != 0 {
+		t.Errorf("Expected no keys, got %#v, %v", values, err)
+	}
+}
+
+func TestSetHeader(t *testing.T) {
+	ini := NewIni()
+	ini.Set("", "editor", "vim")
+	ini.Set("user", "name", "Marc Weistroff")
+	ini.SetHeader("Generated file.\nDO NOT EDIT")
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Fatal(err)
+	}
+	expected := "; Generated file.\n; DO NOT EDIT\n\neditor=vim\n[user]\nname=Marc Weistroff\n"
+	if v := buffer.String(); v != expected {
+		t.Errorf("Expected %#v, got %#v", expected, v)
+	}
+
+	read, err := LoadString(buffer.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := read.Len(); v != 2 {
+		t.Errorf("Expected 2 keys, got %d", v)
+	}
+	if v := read.Comment("", "editor"); v != "" {
+		t.Errorf("Expected the header not to be read as a key comment, got %#v", v)
+	}
+
+	ini.SetCommentPrefixes()
+	ini.SetComment("user", "name", "Author")
+	buffer.Reset()
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Fatal(err)
+	}
+	expected = "editor=vim\n[user]\nname=Marc Weistroff\n"
+	if v := buffer.String(); v != expected {
+		t.Errorf("Expected no comments without comment prefix, got %#v", v)
+	}
+	read = NewIni()
+	read.SetCommentPrefixes()
+	if _, err := read.ReadFrom(buffer); err != nil {
+		t.Errorf("Expected the output to parse without comment prefix, got %v", err)
+	}
+}
+
+func TestReloadFrom(t *testing.T) {
+	ini, err := LoadString(gitConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ini.ReloadFrom(strings.NewReader("[user]\nname = Someone\nbroken\n")); err == nil {
+		t.Error("Expected a parse error")
+	}
+	if v := ini.Len(); v != 17 {
+		t.Errorf("Expected the 17 previous keys to survive, got %d", v)
+	}
+	if v := ini.Get("user", "name"); v != "Marc Weistroff" {
+		t.Errorf("Expected \"Marc Weistroff\", got %#v", v)
+	}
+
+	if err := ini.ReloadFrom(strings.NewReader("[user]\nname = Someone\n")); err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Len(); v != 1 {
+		t.Errorf("Expected 1 key, got %d", v)
+	}
+	if v := ini.Get("user", "name"); v != "Someone" {
+		t.Errorf("Expected \"Someone\", got %#v", v)
+	}
+}
+
+func TestGetStringMap(t *testing.T) {
+	ini, err := LoadString("[app]\ndb.host = localhost\ndb.port = 5432\ndb.pool.size = 10\ndbname = app\ncache.host = redis\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := ini.GetStringMap("app", "db")
+	expected := map[string]string{"host": "localhost", "port": "5432", "pool.size": "10"}
+	if len(values) != len(expected) {
+		t.Errorf("Expected %d keys, got %#v", len(expected), values)
+	}
+	for key, value := range expected {
+		if v := values[key]; v != value {
+			t.Errorf("Expected %#v for %s, got %#v", value, key, v)
+		}
+	}
+	if v := ini.GetStringMap("app", "missing"); len(v) != 0 {
+		t.Errorf("Expected an empty map, got %#v", v)
+	}
+}
+
+func TestQuotedValueKeepsSpaces(t *testing.T) {
+	ini, err := LoadString("[a]\nspaced = \"  x  \"\ntabbed=\"\tx\t\"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("a", "spaced"); v != "  x  " {
+		t.Errorf("Expected \"  x  \", got %#v", v)
+	}
+	if v := ini.Get("a", "tabbed"); v != "\tx\t" {
+		t.Errorf("Expected \"\\tx\\t\", got %#v", v)
+	}
+}
+
+func TestSetUnescapeQuoted(t *testing.T) {
+	raw, err := LoadString(gitConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := raw.Get("alias", "lga"); v != `!sh -c 'git log --author=\"$1\" -p $2' -` {
+		t.Errorf("Expected the raw alias, got %#v", v)
+	}
+
+	ini := NewIni()
+	ini.SetUnescapeQuoted(true)
+	if _, err := ini.ReadFrom(strings.NewReader(gitConfig)); err != nil {
+		t.Fatal(err)
+	}
+	expected := `!sh -c 'git log --author="$1" -p $2' -`
+	if v := ini.Get("alias", "lga"); v != expected {
+		t.Errorf("Expected %#v, got %#v", expected, v)
+	}
+	if v := ini.Get("alias", "sdi"); v != "diff --staged" {
+		t.Errorf("Expected unquoted values to be unchanged, got %#v", v)
+	}
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Fatal(err)
+	}
+	read := NewIni()
+	read.SetUnescapeQuoted(true)
+	if _, err := read.ReadFrom(buffer); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"lga", "lint"} {
+		if v, expected := read.Get("alias", key), ini.Get("alias", key); v != expected {
+			t.Errorf("Expected %#v for %s, got %#v", expected, key, v)
+		}
+	}
+}
+
+func TestSetUnescapeQuotedTrailingQuote(t *testing.T) {
+	for _, lineParser := range []bool{false, true} {
+		ini := NewIni()
+		ini.SetLineParser(lineParser)
+		ini.SetUnescapeQuoted(true)
+		if _, err := ini.ReadFrom(strings.NewReader(`greeting = "say \"hi\""`)); err != nil {
+			t.Fatal(err)
+		}
+		if v := ini.Get("", "greeting"); v != `say "hi"` {
+			t.Errorf("line parser %v: expected %#v, got %#v", lineParser, `say "hi"`, v)
+		}
+	}
+}
+
+func TestIniLoadInvalidUTF8(t *testing.T) {
+	if _, err := LoadString("[a]\nk=\xff\n"); err == nil || !strings.Contains(err.Error(), "invalid UTF-8") {
+		t.Errorf("Expected an invalid UTF-8 error, got %v", err)
+	}
+}
+
+func TestIniLoadUnterminatedString(t *testing.T) {
+	for _, input := range []string{`a = "`, `a = "abc`, "a = \"abc\\\"\n"} {
+		if _, err := LoadString(input); err == nil || !strings.Contains(err.Error(), "unterminated string") {
+			t.Errorf("Expected an unterminated string error for %#v, got %v", input, err)
+		}
+	}
+}
+
+func TestSectionMapOrDefault(t *testing.T) {
+	ini, err := LoadString(gitConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := map[string]string{"token": "none"}
+
+	values := ini.SectionMapOrDefault("ghi", def)
+	if len(values) != 1 || values["token"] != "4d3cf26439283fake6fd7ef50c8c6e3c" {
+		t.Errorf("Expected the ghi section, got %#v", values)
+	}
+	values["token"] = "changed"
+	if v := ini.Get("ghi", "token"); v != "4d3cf26439283fake6fd7ef50c8c6e3c" {
+		t.Errorf("Expected a copy of the section, got %#v", v)
+	}
+
+	if values := ini.SectionMapOrDefault("missing", def); len(values) != 1 || values["token"] != "none" {
+		t.Errorf("Expected the default, got %#v", values)
+	}
+}
+
+// generatedReader produces lines key lines on the fly, without holding the
+// whole input.
+type generatedReader struct {
+	lines, read int
+	pending     []byte
+}
+
+func (r *generatedReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		if r.read == r.lines {
+			return 0, io.EOF
+		}
+		r.pending = []byte(fmt.Sprintf("key%d = value%d\n", r.read, r.read))
+		r.read++
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func TestParseStreams(t *testing.T) {
+	r := &generatedReader{lines: 200000}
+	keys, readAtFirstKey := 0, 0
+	err := Parse(r, func(section, key, value string) error {
+		if keys == 0 {
+			readAtFirstKey = r.read
+		}
+		keys++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys != r.lines {
+		t.Errorf("Expected %d keys, got %d", r.lines, keys)
+	}
+	if readAtFirstKey >= r.lines {
+		t.Errorf("Expected the first key before the end of the input, got it after %d lines", readAtFirstKey)
+	}
+}
+
+func TestInlineComments(t *testing.T) {
+	ini, err := LoadString("[style]\ncolor = #ff0000\nx = 1 # note\ny = 2\t; note\nurl = http://example.org/#anchor\nquoted = \"a # b\" # note\nhash = a#b\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"color":  "#ff0000",
+		"x":      "1",
+		"y":      "2",
+		"url":    "http://example.org/#anchor",
+		"quoted": "a # b",
+		"hash":   "a#b",
+	}
+	for key, value := range expected {
+		if v := ini.Get("style", key); v != value {
+			t.Errorf("Expected %#v for %s, got %#v", value, key, v)
+		}
+	}
+	if v := ini.Len(); v != len(expected) {
+		t.Errorf("Expected %d keys, got %d", len(expected), v)
+	}
+}
+
+func TestSetAll(t *testing.T) {
+	ini := NewIni()
+	ini.Set("db", "host", "example.com")
+	kv := map[string]string{"host": "localhost", "port": "5432", "name": "app"}
+	ini.SetAll("db", kv)
+
+	for key, value := range kv {
+		if v := ini.Get("db", key); v != value {
+			t.Errorf("Expected %#v for %s, got %#v", value, key, v)
+		}
+	}
+	if v := strings.Join(ini.Keys("db"), ","); v != "host,name,port" {
+		t.Errorf("Expected \"host,name,port\", got %#v", v)
+	}
+}
+
+func TestSetMergeDuplicateSections(t *testing.T) {
+	config := "[core]\neditor = vim\n[user]\nname = Marc\n[core]\npager = less\n"
+	ini, err := LoadString(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.SectionLen("core"); v != 2 {
+		t.Errorf("Expected the duplicate sections to be merged, got %d keys", v)
+	}
+
+	ini = NewIni()
+	ini.SetMergeDuplicateSections(false)
+	if _, err := ini.ReadFrom(strings.NewReader(config)); err == nil || !strings.Contains(err.Error(), `duplicate section "core"`) {
+		t.Errorf("Expected a duplicate section error, got %v", err)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	ini, err := LoadString(gitConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := ini.Entries()
+	if len(entries) != 17 {
+		t.Errorf("Expected 17 entries, got %d", len(entries))
+	}
+	expected := Entry{Section: "user", Key: "name", Value: "Marc Weistroff"}
+	if len(entries) > 0 && entries[0] != expected {
+		t.Errorf("Expected %#v, got %#v", expected, entries[0])
+	}
+}
+
+func TestInlineCommentRoundTrip(t *testing.T) {
+	ini, err := LoadString("[server]\nport = 8080 ; default port\nhost = \"localhost\" # loopback\nempty =\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.InlineComment("server", "port"); v != "default port" {
+		t.Errorf("Expected \"default port\", got %#v", v)
+	}
+	if v := ini.InlineComment("server", "host"); v != "loopback" {
+		t.Errorf("Expected \"loopback\", got %#v", v)
+	}
+	ini.SetInlineComment("server", "empty", "unset")
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Fatal(err)
+	}
+	expected := "[server]\nport=8080 ; default port\nhost=\"localhost\" ; loopback\nempty=\"\" ; unset\n"
+	if v := buffer.String(); v != expected {
+		t.Errorf("Expected %#v, got %#v", expected, v)
+	}
+
+	read, err := LoadString(buffer.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"port", "host", "empty"} {
+		if v, expected := read.Get("server", key), ini.Get("server", key); v != expected {
+			t.Errorf("Expected %#v for %s, got %#v", expected, key, v)
+		}
+		if v, expected := read.InlineComment("server", key), ini.InlineComment("server", key); v != expected {
+			t.Errorf("Expected comment %#v for %s, got %#v", expected, key, v)
+		}
+	}
+}
+
+func TestGetOrSet(t *testing.T) {
+	ini := NewIni()
+	if v := ini.GetOrSet("cache", "ttl", "60"); v != "60" {
+		t.Errorf("Expected \"60\", got %#v", v)
+	}
+	if v := ini.GetOrSet("cache", "ttl", "120"); v != "60" {
+		t.Errorf("Expected the first value \"60\", got %#v", v)
+	}
+	if v := ini.Get("cache", "ttl"); v != "60" {
+		t.Errorf("Expected \"60\", got %#v", v)
+	}
+}
+
+func TestParseSectionName(t *testing.T) {
+	ini := NewIni()
+	if base, tag := ini.ParseSectionName("feature:enabled"); base != "feature" || tag != "enabled" {
+		t.Errorf("Expected \"feature\", \"enabled\", got %#v, %#v", base, tag)
+	}
+	if base, tag := ini.ParseSectionName("core"); base != "core" || tag != "" {
+		t.Errorf("Expected \"core\", \"\", got %#v, %#v", base, tag)
+	}
+
+	ini.SetSectionSeparator(" ")
+	if base, tag := ini.ParseSectionName("remote origin"); base != "remote" || tag != "origin" {
+		t.Errorf("Expected \"remote\", \"origin\", got %#v, %#v", base, tag)
+	}
+}
+
+func TestSetLineEnding(t *testing.T) {
+	ini := NewIni()
+	ini.Set("user", "name", "Marc Weistroff")
+	ini.Set("user", "email", "marc@example.org")
+	ini.SetComment("user", "email", "contact")
+	ini.SetLineEnding("\r\n")
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Fatal(err)
+	}
+	expected := "[user]\r\nname=Marc Weistroff\r\n; contact\r\nemail=marc@example.org\r\n"
+	if v := buffer.String(); v != expected {
+		t.Errorf("Expected %#v, got %#v", expected, v)
+	}
+
+	read, err := LoadString(buffer.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := read.Get("user", "email"); v != "marc@example.org" {
+		t.Errorf("Expected \"marc@example.org\", got %#v", v)
+	}
+	if v := read.Comment("user", "email"); v != "contact" {
+		t.Errorf("Expected \"contact\", got %#v", v)
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	ini, err := LoadString(gitConfig)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ini.Get("alias", "lint")
+		ini.Get("missing", "lint")
+	}
+}
+
+func TestGetRaw(t *testing.T) {
+	ini := NewIni()
+	ini.SetUnescape(true)
+	_, err := ini.ReadFrom(strings.NewReader("[a]\nquoted = \"localhost\" ; comment\nescaped = a\\tb\nplain = value  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][2]string{
+		"quoted":  {"localhost", `"localhost"`},
+		"escaped": {"a\tb", `a\tb`},
+		"plain":   {"value", "value"},
+	}
+	for key, values := range expected {
+		if v := ini.Get("a", key); v != values[0] {
+			t.Errorf("Expected %#v for %s, got %#v", values[0], key, v)
+		}
+		if v := ini.GetRaw("a", key); v != values[1] {
+			t.Errorf("Expected raw %#v for %s, got %#v", values[1], key, v)
+		}
+	}
+
+	ini.Set("a", "quoted", "example.com")
+	if v := ini.GetRaw("a", "quoted"); v != "example.com" {
+		t.Errorf("Expected the value set, got %#v", v)
+	}
+}
+
+func TestSetGlobalSectionAlias(t *testing.T) {
+	config := "[global]\nx=1\n[]\ny=2\n[user]\nname=Marc\n"
+	ini := NewIni()
+	ini.SetGlobalSectionAlias("global")
+	if _, err := ini.ReadFrom(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("", "x"); v != "1" {
+		t.Errorf("Expected \"1\", got %#v", v)
+	}
+	if v := ini.Get("", "y"); v != "2" {
+		t.Errorf("Expected \"2\", got %#v", v)
+	}
+	if ini.HasSection("global") {
+		t.Error("Expected no global section")
+	}
+
+	ini, err := LoadString(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ini.Get("global", "x"); v != "1" {
+		t.Errorf("Expected the global section without alias, got %#v", v)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	ini, err := LoadString(gitConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errToken := errors.New("token found")
+	visited := 0
+	err = ini.Walk(func(section, key, value string) error {
+		visited++
+		if key == "token" {
+			return errToken
+		}
+		return nil
+	})
+	if err != errToken {
+		t.Errorf("Expected the callback error, got %v", err)
+	}
+	if visited != 17 {
+		t.Errorf("Expected 17 keys visited, got %d", visited)
+	}
+
+	visited = 0
+	err = ini.Walk(func(section, key, value string) error {
+		visited++
+		if section == "user" {
+			return errToken
+		}
+		return nil
+	})
+	if err != errToken || visited != 1 {
+		t.Errorf("Expected Walk to stop at the first key, got %v after %d keys", err, visited)
+	}
+}
+
+func TestSetDisallowEmptyValues(t *testing.T) {
+	if _, err := LoadString(phpIni); err != nil {
+		t.Errorf("Expected empty values to be allowed by default, got %v", err)
+	}
+
+	ini := NewIni()
+	ini.SetDisallowEmptyValues(true)
+	_, err := ini.ReadFrom(strings.NewReader(phpIni))
+	if err == nil || !strings.Contains(err.Error(), `empty value for "unserialize_callback_func"`) {
+		t.Errorf("Expected an empty value error, got %v", err)
+	}
+	if _, err := ini.ReadFrom(strings.NewReader(gitConfig)); err != nil {
+		t.Errorf("Expected no error without empty values, got %v", err)
+	}
+}
+
+func TestPrefixSections(t *testing.T) {
+	ini, err := LoadString("editor = vim\n[user]\nname = Marc\n[git.user]\nname = Other\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ini.PrefixSections("git.")
+
+	expected := map[string]string{"git.": "vim", "git.user": "Marc", "git.git.user": "Other"}
+	for section, value := range expected {
+		key := "name"
+		if section == "git." {
+			key = "editor"
+		}
+		if v := ini.Get(section, key); v != value {
+			t.Errorf("Expected %#v in %s, got %#v", value, section, v)
+		}
+	}
+	if ini.HasSection("user") || ini.HasSection("") {
+		t.Error("Expected the old sections to be gone")
+	}
+	if v, _ := ini.SectionAt(0); v != "git." {
+		t.Errorf("Expected the section order to be kept, got %#v", v)
+	}
+}
+
+func TestReadFromWithWarnings(t *testing.T) {
+	config := "[user]\nname = Marc\nstray line\nname = Marc Weistroff\n[core]\neditor = vim\n"
+	for _, lineParser := range []bool{false, true} {
+		ini := NewIni()
+		ini.SetLineParser(lineParser)
+		warnings, err := ini.ReadFromWithWarnings(strings.NewReader(config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []Warning{
+			{Line: 3, Message: `Ignored line "stray line" without '='`},
+			{Line: 4, Message: `Duplicate key "name" in section "user"`},
+		}
+		if len(warnings) != len(expected) {
+			t.Fatalf("Expected %d warnings, got %#v", len(expected), warnings)
+		}
+		for i, w := range expected {
+			if warnings[i] != w {
+				t.Errorf("Expected %#v, got %#v", w, warnings[i])
+			}
+		}
+		if v := ini.Get("user", "name"); v != "Marc Weistroff" {
+			t.Errorf("Expected \"Marc Weistroff\", got %#v", v)
+		}
+		if v := ini.Get("core", "editor"); v != "vim" {
+			t.Errorf("Expected \"vim\", got %#v", v)
+		}
+
+		if _, err := ini.ReadFrom(strings.NewReader(config)); err == nil {
+			t.Error("Expected ReadFrom to fail on the stray line")
+		}
+	}
+}
+
+func TestWriteSection(t *testing.T) {
+	ini, err := LoadString(phpIni)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteSection(buffer, "PHP"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "[PHP]\nengine=On\nshort_open_tag=Off\nunserialize_callback_func=\nerror_log=/usr/local/var/log/php-error.log\n"
+	if v := buffer.String(); v != expected {
+		t.Errorf("Expected %#v, got %#v", expected, v)
+	}
+	if strings.Contains(buffer.String(), "CLI Server") {
+		t.Error("Expected the other sections to be absent")
+	}
+
+	if _, err := ini.WriteSection(buffer, "missing"); err == nil {
+		t.Error("Expected an error for a missing section")
+	}
+}
+
+func TestSetKeyNormalizer(t *testing.T) {
+	ini := NewIni()
+	ini.SetKeyNormalizer(func(key string) string {
+		return strings.ToLower(strings.TrimSpace(key))
+	})
+	ini.Set("app", "  Foo ", "bar")
+
+	if v := ini.Get("app", "foo"); v != "bar" {
+		t.Errorf("Expected \"bar\", got %#v", v)
+	}
+	if v := ini.Get("app", "FOO"); v != "bar" {
+		t.Errorf("Expected \"bar\", got %#v", v)
+	}
+	if !ini.Has("app", " foo") {
+		t.Error("Expected Has to normalize the key")
+	}
+	if v := ini.Keys("app"); len(v) != 1 || v[0] != "foo" {
+		t.Errorf("Expected the key to be stored as \"foo\", got %#v", v)
+	}
+}
+
+func TestSetKeyNormalizerStoredKeys(t *testing.T) {
+	normalize := func(key string) string {
+		return strings.ReplaceAll(key, " ", "_")
+	}
+	ini := NewIni()
+	ini.SetKeyNormalizer(normalize)
+	ini.Set("s", "a b", "1")
+	ini.AppendValue("s", "m n", "x")
+	ini.AppendValue("s", "m n", "y")
+
+	for _, key := range ini.Keys("s") {
+		if !ini.Has("s", key) {
+			t.Errorf("Expected stored key %#v to be found", key)
+		}
+	}
+	if v := ini.Get("s", ini.Keys("s")[0]); v != "1" {
+		t.Errorf("Expected \"1\", got %#v", v)
+	}
+
+	other := NewIni()
+	other.SetKeyNormalizer(normalize)
+	other.Merge(ini)
+	if v := other.Keys("s"); strings.Join(v, ",") != "a_b,m_n" {
+		t.Errorf("Expected the keys to be merged as stored, got %#v", v)
+	}
+
+	buffer := new(bytes.Buffer)
+	if _, err := ini.WriteTo(buffer); err != nil {
+		t.Fatal(err)
+	}
+	read := NewIni()
+	read.SetKeyNormalizer(normalize)
+	if _, err := read.ReadFrom(buffer); err != nil {
+		t.Fatal(err)
+	}
+	if v := read.Get("s", "a b"); v != "1" {
+		t.Errorf("Expected \"1\" after a round-trip, got %#v", v)
+	}
+	if v := read.Keys("s"); strings.Join(v, ",") != "a_b,m_n" {
+		t.Errorf("Expected the keys to be kept after a round-trip, got %#v", v)
+	}
+}
@@ -0,0 +1,54 @@
+package ini
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// referenceRegexp matches the ${section:key} references to other keys.
+var referenceRegexp = regexp.MustCompile(`\${([^{}:]+):([^{}]+)}`)
+
+// GetInterpolated() returns the value associated to section and key with
+// every ${section:key} reference replaced by the interpolated value of the
+// referenced key, as Python's ExtendedInterpolation does. The returned error
+// wraps ErrKeyNotFound if key or a referenced key does not exist, and reports
+// references forming a cycle.
+func (ini *Ini) GetInterpolated(section, key string) (string, error) {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	return ini.interpolate(section, key, make(map[string]bool))
+}
+
+// interpolate resolves the references of the value of key. visiting holds the
+// keys being resolved so that cycles are detected.
+func (ini *Ini) interpolate(section, key string, visiting map[string]bool) (string, error) {
+	key = ini.normalizeKey(key)
+	value, ok := ini.data[section][key]
+	if !ok {
+		return "", keyError(section, key, ErrKeyNotFound)
+	}
+	id := section + ":" + key
+	if visiting[id] {
+		return "", keyError(section, key, fmt.Errorf("Interpolation cycle on ${%s}", id))
+	}
+	visiting[id] = true
+	defer delete(visiting, id)
+
+	var err error
+	value = referenceRegexp.ReplaceAllStringFunc(value, func(reference string) string {
+		if err != nil {
+			return ""
+		}
+		match := referenceRegexp.FindStringSubmatch(reference)
+		var resolved string
+		if resolved, err = ini.interpolate(match[1], match[2], visiting); err != nil {
+			err = keyError(section, key, err)
+		}
+		return resolved
+	})
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
@@ -0,0 +1,40 @@
+package ini
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGetInterpolated(t *testing.T) {
+	ini, err := LoadString(`[paths]
+home = /home/marc
+[app]
+data = ${paths:home}/data
+cache = ${app:data}/cache
+broken = ${paths:missing}/x
+[a]
+x = ${b:y}
+[b]
+y = ${a:x}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := ini.GetInterpolated("app", "cache"); err != nil || v != "/home/marc/data/cache" {
+		t.Errorf("Expected \"/home/marc/data/cache\", got %#v, %v", v, err)
+	}
+	if v, err := ini.GetInterpolated("paths", "home"); err != nil || v != "/home/marc" {
+		t.Errorf("Expected \"/home/marc\", got %#v, %v", v, err)
+	}
+	if _, err := ini.GetInterpolated("app", "broken"); !errors.Is(err, ErrKeyNotFound) || !strings.Contains(err.Error(), `"missing"`) {
+		t.Errorf("Expected ErrKeyNotFound for the missing reference, got %v", err)
+	}
+	if _, err := ini.GetInterpolated("a", "x"); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Expected a cycle error, got %v", err)
+	}
+	if _, err := ini.GetInterpolated("app", "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
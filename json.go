@@ -0,0 +1,34 @@
+package ini
+
+import (
+	"encoding/json"
+)
+
+// MarshalJSON() encodes the configuration as a JSON object of sections, each
+// being an object of keys and values.
+func (ini *Ini) MarshalJSON() ([]byte, error) {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	return json.Marshal(ini.data)
+}
+
+// UnmarshalJSON() replaces the configuration with the one encoded in data by
+// MarshalJSON(). Sections and keys are inserted in alphabetical order.
+func (ini *Ini) UnmarshalJSON(data []byte) error {
+	var decoded map[string]map[string]string
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.clear()
+	for _, section := range sortedKeys(decoded) {
+		for _, key := range sortedKeys(decoded[section]) {
+			ini.set(section, ini.normalizeKey(key), decoded[section][key])
+		}
+	}
+	return nil
+}
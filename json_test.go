@@ -0,0 +1,34 @@
+package ini
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	ini, err := LoadString(phpIni)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(ini)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ini2 := NewIni()
+	ini2.Set("stale", "key", "value")
+	if err := json.Unmarshal(data, ini2); err != nil {
+		t.Fatal(err)
+	}
+	if ini2.HasSection("stale") {
+		t.Error("Unmarshaling should replace existing data")
+	}
+	for _, key := range []string{"engine", "short_open_tag", "unserialize_callback_func", "error_log"} {
+		if v, ok := ini2.GetOK("PHP", key); !ok || v != ini.Get("PHP", key) {
+			t.Errorf("%s: expected %#v, got %#v", key, ini.Get("PHP", key), v)
+		}
+	}
+	if v := ini2.Get("CLI Server", "cli_server.color"); v != "On" {
+		t.Errorf("Expected \"On\", got %#v", v)
+	}
+}
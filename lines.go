@@ -0,0 +1,245 @@
+package ini
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// SetLineParser() makes ReadFrom() use a line based parser built on
+// bufio.Scanner instead of the default text/scanner tokenizer. Both read the
+// same configurations identically, except that with the line parser a double
+// quote only starts a quoted value at the beginning of the value, elsewhere it
+// is kept as is, keys may contain double quotes and invalid UTF-8 is kept as is
+// rather than being an error.
+func (ini *Ini) SetLineParser(lineParser bool) {
+	ini.rw.Lock()
+	defer ini.rw.Unlock()
+
+	ini.lineParser = lineParser
+}
+
+// parseLines is the line based implementation of parse.
+func (ini *Ini) parseLines(r io.Reader, included map[string]bool, handle func(*item) error) (int64, error) {
+	lines := bufio.NewScanner(r)
+	lines.Split(scanLines)
+	if ini.maxLineLength > 0 {
+		lines.Buffer(nil, ini.maxLineLength*utf8.UTFMax+1)
+	} else {
+		lines.Buffer(nil, math.MaxInt32)
+	}
+
+	currentSection := ""
+	blankLines := 0
+	var comments []string         // comment lines preceding the current line
+	seen := make(map[string]bool) // section headers read so far
+	number := 0
+	for lines.Scan() {
+		number++
+		pos := fmt.Sprintf("%d:1", number)
+		line := lines.Text()
+		if number == 1 {
+			// text/scanner discards a leading byte order mark too.
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+		if ini.maxLineLength > 0 && utf8.RuneCountInString(line) > ini.maxLineLength {
+			return -1, fmt.Errorf("While reading a line, got a line longer than %d characters. %s", ini.maxLineLength, pos)
+		}
+
+		// Indentation is ignored.
+		line = strings.TrimLeft(line, string([]rune{tokenSpace, tokenTab}))
+		comment, isComment := ini.commentText(line)
+		switch {
+		case line == "":
+			blankLines++
+			comments = nil
+		case isComment:
+			comments = append(comments, comment)
+		case line[0] == tokenDirective && ini.includeDir != "":
+			if err := ini.directive(strings.TrimSpace(line), pos, included, handle); err != nil {
+				return -1, err
+			}
+		case line[0] == tokenSectionStart:
+			end := strings.IndexRune(line, tokenSectionStop)
+			if end == -1 {
+				return -1, fmt.Errorf("While reading a section, got newline. %s", pos)
+			}
+			if err := ini.checkSectionEnd(line[end+1:], pos); err != nil {
+				return -1, err
+			}
+			var err error
+			if currentSection, err = ini.sectionName(strings.TrimSpace(line[1:end]), pos, seen); err != nil {
+				return -1, err
+			}
+			if err := handle(&item{isSection: true, section: currentSection, layout: layout{blankLines: blankLines}, line: number}); err != nil {
+				return -1, err
+			}
+			blankLines = 0
+			comments = nil
+		default:
+			key, rest, delimited := strings.Cut(line, "=")
+			key = strings.TrimSpace(key)
+			if !delimited && !ini.allowBareKeys {
+				if ini.warn == nil {
+					return -1, fmt.Errorf("While reading a key, expected '=' in key line. %s", pos)
+				}
+				ini.warn(Warning{Line: number, Message: fmt.Sprintf("Ignored line %q without '='", key)})
+				blankLines = 0
+				comments = nil
+				break
+			}
+			if currentSection == "" && !ini.allowGlobalKeys {
+				return -1, fmt.Errorf("While reading a key, got %q outside any section. %s", key, pos)
+			}
+			value, l := "", layout{}
+			if delimited {
+				var err error
+				if value, l, err = ini.lineValue(rest, pos); err != nil {
+					return -1, err
+				}
+			}
+			if value == "" && ini.disallowEmpty {
+				return -1, fmt.Errorf("While reading a value, got an empty value for %q. %s", key, pos)
+			}
+			l.blankLines, l.comment = blankLines, strings.Join(comments, "\n")
+			if err := handle(ini.keyItem(currentSection, key, value, l, number)); err != nil {
+				return -1, err
+			}
+			blankLines = 0
+			comments = nil
+		}
+	}
+	if err := lines.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return -1, fmt.Errorf("While reading a line, got a line longer than %d characters. %d:1", ini.maxLineLength, number+1)
+		}
+		return -1, err
+	}
+	return 0, nil
+}
+
+// lineValue reads the value found after the '=' of a key line read at pos,
+// as readValue does.
+func (ini *Ini) lineValue(value, pos string) (string, layout, error) {
+	if ini.trimValues {
+		value = strings.TrimLeft(value, string([]rune{tokenSpace, tokenTab}))
+	}
+	if strings.HasPrefix(value, `"`) {
+		end := closingQuote(value)
+		if end == -1 {
+			return "", layout{}, fmt.Errorf("While reading a value, got an unterminated string. %s", pos)
+		}
+		text := value[:end+1]
+		if err := ini.checkValueLength(end-1, pos); err != nil {
+			return "", layout{}, err
+		}
+		l := layout{quoted: true, raw: text}
+		l.inline, _ = ini.commentText(strings.TrimLeft(value[end+1:], string([]rune{tokenSpace, tokenTab})))
+		if ini.unescape || ini.unescapeQuoted {
+			return decodeEscapes(text[1:end]), l, nil
+		}
+		return decodeNewlines(text[1:end]), l, nil
+	}
+
+	buffer, l := new(bytes.Buffer), layout{}
+	blanks := 0 // spaces and tabs read literally at the end of buffer
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if ini.isCommentStart(rune(c)) && isBlankEnded(buffer.String()) {
+			if comment, isComment := ini.commentText(value[i:]); isComment {
+				l.inline = comment
+				value = value[:i]
+				break
+			}
+		}
+		if c == tokenSpace || c == tokenTab {
+			blanks++
+		} else {
+			blanks = 0
+		}
+		if c == tokenEscape && ini.unescape && i+1 < len(value) {
+			switch value[i+1] {
+			case 'n':
+				buffer.WriteByte('\n')
+				i++
+				continue
+			case 'r':
+				buffer.WriteByte('\r')
+				i++
+				continue
+			case 't':
+				buffer.WriteByte('\t')
+				i++
+				continue
+			case tokenEscape, '"':
+				buffer.WriteByte(value[i+1])
+				i++
+				continue
+			}
+		}
+		buffer.WriteByte(c)
+		if err := ini.checkValueLength(buffer.Len(), pos); err != nil {
+			return "", layout{}, err
+		}
+	}
+	l.raw = ini.trimValue(value)
+	return ini.trimBlanks(buffer.String(), blanks), l, nil
+}
+
+// commentText returns the text of line without its comment prefix and the
+// surrounding whitespace, and true if line starts with a comment prefix.
+func (ini *Ini) commentText(line string) (string, bool) {
+	for _, prefix := range ini.commentPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, prefix)), true
+		}
+	}
+	return "", false
+}
+
+// closingQuote returns the index of the double quote closing the quoted value
+// starting at value[0], skipping escaped quotes, or -1 if there is none.
+func closingQuote(value string) int {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case tokenEscape:
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// scanLines is a bufio.SplitFunc splitting lines ended by "\n", "\r" or
+// "\r\n", as isLineEnd does.
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		// A "\n" may follow the "\r".
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,81 @@
+package ini
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// readBoth reads config with both parsers and returns the results.
+func readBoth(t *testing.T, config string, configure func(*Ini)) (*Ini, *Ini) {
+	tokens, lines := NewIni(), NewIni()
+	lines.SetLineParser(true)
+	for _, ini := range []*Ini{tokens, lines} {
+		ini.SetPreserveFormatting(true)
+		if configure != nil {
+			configure(ini)
+		}
+		if _, err := ini.ReadFrom(strings.NewReader(config)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tokens, lines
+}
+
+func TestLineParserFixtures(t *testing.T) {
+	for name, config := range map[string]string{"git": gitConfig, "php": phpIni} {
+		tokens, lines := readBoth(t, config, nil)
+
+		expected, entries := tokens.Entries(), lines.Entries()
+		if len(entries) != len(expected) {
+			t.Fatalf("%s: expected %d entries, got %d", name, len(expected), len(entries))
+		}
+		for i, e := range expected {
+			if entries[i] != e {
+				t.Errorf("%s: expected %#v, got %#v", name, e, entries[i])
+			}
+			if v := lines.GetRaw(e.Section, e.Key); v != tokens.GetRaw(e.Section, e.Key) {
+				t.Errorf("%s: expected raw %#v, got %#v", name, tokens.GetRaw(e.Section, e.Key), v)
+			}
+		}
+
+		a, b := new(bytes.Buffer), new(bytes.Buffer)
+		tokens.WriteTo(a)
+		lines.WriteTo(b)
+		if a.String() != b.String() {
+			t.Errorf("%s: expected %#v, got %#v", name, a.String(), b.String())
+		}
+	}
+}
+
+func TestLineParserEdgeCases(t *testing.T) {
+	config := "\uFEFF; header\r\n\r\n[a]\r// note\rb = x\\ty # inline\ntabbed=\t1\t2\t\nquoted = \"a \\\"b\\\" # c\" ; d\n[global]\nc=1\n"
+	tokens, lines := readBoth(t, config, func(ini *Ini) {
+		ini.SetCommentPrefixes(";", "#", "//")
+		ini.SetUnescape(true)
+		ini.SetGlobalSectionAlias("global")
+	})
+
+	for _, key := range [][2]string{{"a", "b"}, {"a", "tabbed"}, {"a", "quoted"}, {"", "c"}} {
+		if v, expected := lines.Get(key[0], key[1]), tokens.Get(key[0], key[1]); v != expected {
+			t.Errorf("Expected %#v for %s, got %#v", expected, key[1], v)
+		}
+		if v, expected := lines.Comment(key[0], key[1]), tokens.Comment(key[0], key[1]); v != expected {
+			t.Errorf("Expected comment %#v for %s, got %#v", expected, key[1], v)
+		}
+		if v, expected := lines.InlineComment(key[0], key[1]), tokens.InlineComment(key[0], key[1]); v != expected {
+			t.Errorf("Expected inline comment %#v for %s, got %#v", expected, key[1], v)
+		}
+	}
+	if v := lines.Get("a", "b"); v != "x\ty" {
+		t.Errorf("Expected \"x\\ty\", got %#v", v)
+	}
+
+	ini := NewIni()
+	ini.SetLineParser(true)
+	for _, config := range []string{"[a\nb=1\n", "[a]\nb\n", "[a]\nb=\"1\n"} {
+		if _, err := ini.ReadFrom(strings.NewReader(config)); err == nil {
+			t.Errorf("Expected an error for %#v", config)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package ini
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Type is the type a value is expected to parse as.
+type Type int
+
+const (
+	TypeString Type = iota
+	TypeInt
+	TypeBool
+	TypeFloat
+)
+
+// Rule describes the requirements on a key.
+type Rule struct {
+	Type     Type
+	Required bool
+}
+
+// Schema maps section names to the rules of their keys.
+type Schema map[string]map[string]Rule
+
+// Validate() checks the configuration against schema and returns every
+// violation found: missing required keys and values not parsing as their type.
+func (ini *Ini) Validate(schema Schema) []error {
+	ini.rw.RLock()
+	defer ini.rw.RUnlock()
+
+	var errs []error
+	for _, section := range sortedKeys(schema) {
+		rules := schema[section]
+		for _, key := range sortedKeys(rules) {
+			rule := rules[key]
+			value, ok := ini.data[section][ini.normalizeKey(key)]
+			if !ok {
+				if rule.Required {
+					errs = append(errs, keyError(section, key, ErrKeyNotFound))
+				}
+				continue
+			}
+			if err := rule.Type.check(value); err != nil {
+				errs = append(errs, keyError(section, key, err))
+			}
+		}
+	}
+	return errs
+}
+
+// check returns an error if value does not parse as t.
+func (t Type) check(value string) error {
+	var err error
+	switch t {
+	case TypeInt:
+		_, err = strconv.ParseInt(value, 0, 0)
+	case TypeBool:
+		_, err = strconv.ParseBool(value)
+	case TypeFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case TypeString:
+	default:
+		err = fmt.Errorf("Unknown type %d", t)
+	}
+	return err
+}
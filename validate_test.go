@@ -0,0 +1,50 @@
+package ini
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	ini, err := LoadString("[server]\nport = http\ndebug = true\nratio = 0.5\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := Schema{
+		"server": {
+			"host":  {Type: TypeString, Required: true},
+			"port":  {Type: TypeInt, Required: true},
+			"debug": {Type: TypeBool},
+			"ratio": {Type: TypeFloat},
+			"name":  {Type: TypeString},
+		},
+	}
+
+	errs := ini.Validate(schema)
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %v", errs)
+	}
+	if !errors.Is(errs[0], ErrKeyNotFound) || !strings.Contains(errs[0].Error(), "host") {
+		t.Errorf("Expected missing host, got %v", errs[0])
+	}
+	if !strings.Contains(errs[1].Error(), "port") {
+		t.Errorf("Expected invalid port, got %v", errs[1])
+	}
+
+	ini.Set("server", "host", "localhost")
+	ini.Set("server", "port", "8080")
+	if errs := ini.Validate(schema); len(errs) != 0 {
+		t.Errorf("Expected no errors, got %v", errs)
+	}
+}
+
+func TestValidateLowercaseKeys(t *testing.T) {
+	ini := NewIni()
+	ini.SetLowercaseKeys(true)
+	ini.Set("s", "Port", "8080")
+
+	if errs := ini.Validate(Schema{"s": {"Port": {Type: TypeInt, Required: true}}}); len(errs) != 0 {
+		t.Errorf("Expected no errors, got %v", errs)
+	}
+}